@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// notAbsentCondition is true for rows of users who are not inside an absence period.
+// It is appended to every candidate query next to is_active = true.
+const notAbsentCondition = `NOT EXISTS (
+	SELECT 1 FROM user_absences a
+	WHERE a.user_id = users.user_id AND a.starts_at <= CURRENT_TIMESTAMP AND a.ends_at > CURRENT_TIMESTAMP
+)`
+
+// Absence is a dated period during which a user is not assigned reviews
+type Absence struct {
+	ID           int64   `json:"id"`
+	UserID       string  `json:"user_id"`
+	StartsAt     string  `json:"starts_at"`
+	EndsAt       string  `json:"ends_at"`
+	Reason       string  `json:"reason"`
+	AutoReassign bool    `json:"auto_reassign"`
+	ReassignedAt *string `json:"reassigned_at,omitempty"`
+	// UnreassignedPRIDs are the OPEN reviews that had no replacement when the absence started
+	UnreassignedPRIDs []string `json:"unreassigned_pr_ids"`
+}
+
+// AbsenceRequest is the body of /users/absence/add and /users/absence/update
+type AbsenceRequest struct {
+	ID           int64     `json:"id"`
+	UserID       string    `json:"user_id"`
+	StartsAt     time.Time `json:"starts_at"`
+	EndsAt       time.Time `json:"ends_at"`
+	Reason       string    `json:"reason"`
+	AutoReassign bool      `json:"auto_reassign"`
+}
+
+func (req AbsenceRequest) validate() string {
+	if req.StartsAt.IsZero() || req.EndsAt.IsZero() {
+		return "starts_at and ends_at are required"
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		return "ends_at must be after starts_at"
+	}
+	return ""
+}
+
+const absenceColumns = "id, user_id, starts_at, ends_at, reason, auto_reassign, reassigned_at, unreassigned_pr_ids"
+
+func scanAbsence(row interface{ Scan(...interface{}) error }) (Absence, error) {
+	var a Absence
+	var startsAt, endsAt time.Time
+	var reassignedAt sql.NullTime
+	if err := row.Scan(&a.ID, &a.UserID, &startsAt, &endsAt, &a.Reason, &a.AutoReassign, &reassignedAt, pq.Array(&a.UnreassignedPRIDs)); err != nil {
+		return a, err
+	}
+	if a.UnreassignedPRIDs == nil {
+		a.UnreassignedPRIDs = []string{}
+	}
+	a.StartsAt = startsAt.Format(time.RFC3339)
+	a.EndsAt = endsAt.Format(time.RFC3339)
+	if reassignedAt.Valid {
+		reassigned := reassignedAt.Time.Format(time.RFC3339)
+		a.ReassignedAt = &reassigned
+	}
+	return a, nil
+}
+
+func absenceAddHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AbsenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1)", req.UserID).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "user not found")
+		return
+	}
+
+	// Timestamps are stored in UTC like created_at/merged_at
+	absence, err := scanAbsence(db.QueryRow(`
+		INSERT INTO user_absences (user_id, starts_at, ends_at, reason, auto_reassign)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+absenceColumns,
+		req.UserID, req.StartsAt.UTC(), req.EndsAt.UTC(), req.Reason, req.AutoReassign))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"absence": absence}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// absenceListHandler lists a user's absences; past ones only with include_past=true
+func absenceListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	includePast := r.URL.Query().Get("include_past") == "true"
+
+	rows, err := db.Query(`
+		SELECT `+absenceColumns+` FROM user_absences
+		WHERE user_id = $1 AND ($2 OR ends_at > CURRENT_TIMESTAMP)
+		ORDER BY starts_at
+	`, userID, includePast)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	absences := []Absence{}
+	for rows.Next() {
+		absence, err := scanAbsence(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		absences = append(absences, absence)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":  userID,
+		"absences": absences,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// absenceUpdateHandler changes an absence. Moving its start re-arms automatic reassignment.
+func absenceUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AbsenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	absence, err := scanAbsence(db.QueryRow(`
+		UPDATE user_absences
+		SET starts_at = $2, ends_at = $3, reason = $4, auto_reassign = $5,
+			reassigned_at = CASE WHEN starts_at = $2 THEN reassigned_at END
+		WHERE id = $1
+		RETURNING `+absenceColumns,
+		req.ID, req.StartsAt.UTC(), req.EndsAt.UTC(), req.Reason, req.AutoReassign))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendError(w, http.StatusNotFound, "NOT_FOUND", "absence not found")
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"absence": absence}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func absenceDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM user_absences WHERE id = $1", req.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "absence not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"deleted": req.ID}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// runAbsenceScheduler periodically hands over the open reviews of users whose
+// absence with auto_reassign has just started
+func runAbsenceScheduler(ctx context.Context) {
+	ticker := time.NewTicker(envDuration("ABSENCE_SCHEDULER_INTERVAL", time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := reassignStartedAbsences(); err != nil {
+				log.Printf("Error reassigning reviews of absent users: %v", err)
+			}
+		}
+	}
+}
+
+// reassignStartedAbsences reassigns every OPEN review of users whose absence has
+// started, through the same flow as /pullRequest/reassign, in one transaction. Absence
+// rows are locked with SKIP LOCKED so concurrent replicas split the work instead of
+// repeating it. Every absence is marked done after one pass; reviews nobody could take
+// stay with the user and are recorded on the absence so it does not hold the queue.
+func reassignStartedAbsences() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	rows, err := tx.Query(`
+		SELECT id, user_id FROM user_absences
+		WHERE auto_reassign AND reassigned_at IS NULL
+			AND starts_at <= CURRENT_TIMESTAMP AND ends_at > CURRENT_TIMESTAMP
+		ORDER BY starts_at
+		LIMIT 20
+		FOR UPDATE SKIP LOCKED
+	`)
+	if err != nil {
+		return err
+	}
+
+	type startedAbsence struct {
+		ID     int64
+		UserID string
+	}
+	var started []startedAbsence
+	for rows.Next() {
+		var a startedAbsence
+		if err := rows.Scan(&a.ID, &a.UserID); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		started = append(started, a)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for _, a := range started {
+		report, err := reassignOpenReviews(tx, a.UserID)
+		if err != nil {
+			return err
+		}
+		for _, move := range report.Reassigned {
+			log.Printf("Reassigned %s from absent %s to %s", move.PRID, a.UserID, move.NewReviewer)
+		}
+		unreassigned := []string{}
+		for _, failure := range report.Failed {
+			log.Printf("Could not reassign %s from absent %s: %s", failure.PRID, a.UserID, failure.Message)
+			unreassigned = append(unreassigned, failure.PRID)
+		}
+
+		if _, err := tx.Exec("UPDATE user_absences SET reassigned_at = CURRENT_TIMESTAMP, unreassigned_pr_ids = $1 WHERE id = $2", pq.Array(unreassigned), a.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// openReviews returns the OPEN PRs on which userID is a reviewer
+func openReviews(q dbExecutor, userID string) ([]string, error) {
+	rows, err := q.Query(`
+		SELECT pr.pull_request_id
+		FROM pull_requests pr
+		JOIN pr_reviewers r ON pr.pull_request_id = r.pull_request_id
+		WHERE r.user_id = $1 AND pr.status = 'OPEN'
+		ORDER BY pr.created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	var prIDs []string
+	for rows.Next() {
+		var prID string
+		if err := rows.Scan(&prID); err != nil {
+			return nil, err
+		}
+		prIDs = append(prIDs, prID)
+	}
+	return prIDs, rows.Err()
+}
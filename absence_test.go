@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAbsenceRequestValidate(t *testing.T) {
+	now := time.Now()
+	if msg := (AbsenceRequest{StartsAt: now, EndsAt: now.Add(time.Hour)}).validate(); msg != "" {
+		t.Errorf("Expected valid absence, got %q", msg)
+	}
+	if msg := (AbsenceRequest{StartsAt: now, EndsAt: now}).validate(); msg == "" {
+		t.Error("Expected empty period to be rejected")
+	}
+	if msg := (AbsenceRequest{EndsAt: now}).validate(); msg == "" {
+		t.Error("Expected missing starts_at to be rejected")
+	}
+}
+
+func TestAbsentUserNotAssigned(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"user_id":   "u2",
+		"starts_at": time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+		"ends_at":   time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+		"reason":    "vacation",
+	})
+	w := httptest.NewRecorder()
+	absenceAddHandler(w, httptest.NewRequest(http.MethodPost, "/users/absence/add", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	pr, _, err := createPullRequest(PullRequestCreateRequest{PullRequestID: "pr-1001", PullRequestName: "Add feature", AuthorID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, reviewerID := range pr.AssignedReviewers {
+		if reviewerID == "u2" {
+			t.Error("User on absence should not be assigned as reviewer")
+		}
+	}
+}
+
+func TestAbsenceAutoReassign(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Test PR', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1001', 'u2')")
+	_, _ = testDB.Exec(`INSERT INTO user_absences (user_id, starts_at, ends_at, auto_reassign)
+		VALUES ('u2', CURRENT_TIMESTAMP - INTERVAL '1 minute', CURRENT_TIMESTAMP + INTERVAL '1 day', true)`)
+
+	if err := reassignStartedAbsences(); err != nil {
+		t.Fatal(err)
+	}
+
+	reviewers := getCurrentReviewers(db, "pr-1001")
+	if len(reviewers) != 1 || reviewers[0] != "u3" {
+		t.Errorf("Expected review to move to u3, got %v", reviewers)
+	}
+
+	var reassigned bool
+	_ = testDB.QueryRow("SELECT reassigned_at IS NOT NULL FROM user_absences WHERE user_id = 'u2'").Scan(&reassigned)
+	if !reassigned {
+		t.Error("Expected absence to be marked as processed")
+	}
+}
+
+func TestAbsenceAutoReassignRecordsLeftoverReviews(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Test PR', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1001', 'u2')")
+	_, _ = testDB.Exec(`INSERT INTO user_absences (user_id, starts_at, ends_at, auto_reassign)
+		VALUES ('u2', CURRENT_TIMESTAMP - INTERVAL '1 minute', CURRENT_TIMESTAMP + INTERVAL '1 day', true)`)
+
+	// Nobody can take the review, so it is recorded and the absence leaves the queue
+	if err := reassignStartedAbsences(); err != nil {
+		t.Fatal(err)
+	}
+	absence, err := scanAbsence(testDB.QueryRow("SELECT " + absenceColumns + " FROM user_absences WHERE user_id = 'u2'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if absence.ReassignedAt == nil {
+		t.Error("Expected absence to be marked even though a review could not move")
+	}
+	if len(absence.UnreassignedPRIDs) != 1 || absence.UnreassignedPRIDs[0] != "pr-1001" {
+		t.Errorf("Expected pr-1001 to be recorded, got %v", absence.UnreassignedPRIDs)
+	}
+	if reviewers := getCurrentReviewers(db, "pr-1001"); len(reviewers) != 1 || reviewers[0] != "u2" {
+		t.Errorf("Expected u2 to keep the review, got %v", reviewers)
+	}
+}
+
+func TestOpenReviewsReportsDatabaseErrors(t *testing.T) {
+	closed, err := sql.Open("postgres", "postgres://localhost/unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = closed.Close()
+
+	if _, err := openReviews(closed, "u1"); err == nil {
+		t.Error("Expected a database error instead of no reviews")
+	}
+}
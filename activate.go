@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// teamActivateHandler reactivates every inactive member of a team. With rebalance it
+// also moves OPEN reviews from the most loaded members onto the returning ones.
+func teamActivateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TeamName  string `json:"team_name"`
+		Rebalance bool   `json:"rebalance"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exists, err := teamExists(req.TeamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "team not found")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	rows, err := tx.Query("UPDATE users SET is_active = true WHERE team_name = $1 AND is_active = false RETURNING user_id", req.TeamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	activated := []string{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			_ = rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		activated = append(activated, userID)
+	}
+	if err := rows.Close(); err != nil {
+		log.Printf("Error closing rows: %v", err)
+	}
+
+	moves := []Reassignment{}
+	if req.Rebalance && len(activated) > 0 {
+		receivers := map[string]bool{}
+		for _, userID := range activated {
+			receivers[userID] = true
+		}
+		moves, _, err = rebalanceTeam(tx, req.TeamName, receivers, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"team_name":       req.TeamName,
+		"activated_count": len(activated),
+		"activated":       activated,
+		"moves":           moves,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// reasonAtCapacity is the NO_CANDIDATE reason when every candidate holds their maximum of open reviews
+const reasonAtCapacity = "all at capacity"
+
+// splitByCapacity separates candidates who can take another review from those already
+// holding their maximum of OPEN reviews. A user's own max_open_reviews overrides the
+// team's default_max_open_reviews; with neither set the user is unlimited.
+func splitByCapacity(q dbExecutor, candidates []string) (available, atCapacity []string, err error) {
+	available = []string{}
+	if len(candidates) == 0 {
+		return available, nil, nil
+	}
+
+	rows, err := q.Query(`
+		SELECT u.user_id
+		FROM users u
+		JOIN teams t ON t.team_name = u.team_name
+		WHERE u.user_id = ANY($1)
+			AND COALESCE(u.max_open_reviews, t.default_max_open_reviews) <= (
+				SELECT COUNT(*) FROM pr_reviewers r
+				JOIN pull_requests pr ON pr.pull_request_id = r.pull_request_id
+				WHERE r.user_id = u.user_id AND pr.status = 'OPEN'
+			)
+	`, pq.Array(candidates))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	full := map[string]bool{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, nil, err
+		}
+		full[userID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, userID := range candidates {
+		if full[userID] {
+			atCapacity = append(atCapacity, userID)
+		} else {
+			available = append(available, userID)
+		}
+	}
+	return available, atCapacity, nil
+}
+
+// lockAtCapacity locks the users' rows for the rest of tx and returns those already
+// holding their maximum of OPEN reviews. Taking the locks before counting keeps
+// concurrent assignments from both filling someone's last slot.
+func lockAtCapacity(tx dbExecutor, userIDs []string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	if _, err := tx.Exec("SELECT 1 FROM users WHERE user_id = ANY($1) ORDER BY user_id FOR NO KEY UPDATE", pq.Array(userIDs)); err != nil {
+		return nil, err
+	}
+	_, atCapacity, err := splitByCapacity(tx, userIDs)
+	return atCapacity, err
+}
+
+// usersSetMaxOpenReviewsHandler sets how many OPEN reviews a user may hold at once.
+// null clears the user's own cap so the team default applies.
+func usersSetMaxOpenReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID         string `json:"user_id"`
+		MaxOpenReviews *int   `json:"max_open_reviews"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.MaxOpenReviews != nil && *req.MaxOpenReviews < 0 {
+		http.Error(w, "max_open_reviews must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("UPDATE users SET max_open_reviews = $1 WHERE user_id = $2", req.MaxOpenReviews, req.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "user not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":          req.UserID,
+		"max_open_reviews": req.MaxOpenReviews,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestNullable(t *testing.T) {
+	var req TeamSettingsRequest
+	if err := json.Unmarshal([]byte(`{"team_name": "backend"}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.DefaultMaxOpenReviews.Set {
+		t.Error("Expected omitted field to be unset")
+	}
+
+	if err := json.Unmarshal([]byte(`{"default_max_open_reviews": null}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if !req.DefaultMaxOpenReviews.Set || req.DefaultMaxOpenReviews.Value != nil {
+		t.Errorf("Expected explicit null to clear the value, got %+v", req.DefaultMaxOpenReviews)
+	}
+
+	if err := json.Unmarshal([]byte(`{"default_max_open_reviews": 3}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if v := req.DefaultMaxOpenReviews.Value; v == nil || *v != 3 {
+		t.Errorf("Expected 3, got %+v", req.DefaultMaxOpenReviews)
+	}
+}
+
+func TestCreateSkipsUsersAtCapacity(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, default_max_open_reviews) VALUES ('backend', 1)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	// u3's own cap overrides the team default
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, max_open_reviews) VALUES ('u3', 'Charlie', 'backend', true, 5)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1000', 'Old', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1000', 'u2')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1000', 'u3')")
+
+	pr, report, err := createPullRequest(PullRequestCreateRequest{PullRequestID: "pr-1001", PullRequestName: "Add feature", AuthorID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u3" {
+		t.Errorf("Expected only u3 below capacity, got %v", pr.AssignedReviewers)
+	}
+	if report.UnfilledSlots != 1 || report.UnfilledReason != unfilledAtCapacity {
+		t.Errorf("Expected one slot unfilled at capacity, got %+v", report)
+	}
+}
+
+func TestConcurrentCreatesRespectCapacity(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, default_max_open_reviews) VALUES ('backend', 1)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, _, err := createPullRequest(PullRequestCreateRequest{PullRequestID: fmt.Sprintf("pr-%d", i), AuthorID: "u1"}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var overCap int
+	_ = testDB.QueryRow("SELECT COUNT(*) FROM (SELECT user_id FROM pr_reviewers GROUP BY user_id HAVING COUNT(*) > 1) c").Scan(&overCap)
+	if overCap != 0 {
+		t.Errorf("Expected nobody above max_open_reviews, got %d reviewers", overCap)
+	}
+}
+
+func TestReassignAllAtCapacity(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, max_open_reviews) VALUES ('u3', 'Charlie', 'backend', true, 0)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Add feature', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1001', 'u2')")
+
+	_, _, err := reassignReviewer(PullRequestReassignRequest{PullRequestID: "pr-1001", OldUserID: "u2"})
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.Code != "NO_CANDIDATE" || apiErr.Reason != reasonAtCapacity {
+		t.Errorf("Expected NO_CANDIDATE with reason %q, got %v", reasonAtCapacity, err)
+	}
+}
+
+func TestSplitByCapacityReportsDatabaseErrors(t *testing.T) {
+	closed, err := sql.Open("postgres", "postgres://localhost/unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = closed.Close()
+	saved := db
+	db = closed
+	defer func() { db = saved }()
+
+	// Caps must not be ignored during an outage
+	if available, _, err := splitByCapacity(db, []string{"u1"}); err == nil {
+		t.Errorf("Expected an error, got %v available", available)
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// reasonCodeOwner prefixes the assignment reason of reviewers picked as code owners
+const reasonCodeOwner = "code owner"
+
+// CodeOwnerRule maps a CODEOWNERS-style path pattern to owners. An owner is a user_id,
+// a team group written as @group (GitHub's @org/group form is accepted too) or a forge
+// @login linked through /integrations/accounts/link.
+type CodeOwnerRule struct {
+	Position int      `json:"position"`
+	Pattern  string   `json:"pattern"`
+	Owners   []string `json:"owners"`
+}
+
+// parseCodeOwners reads a CODEOWNERS file. Comments, blank lines and GitLab
+// [Section] headers are skipped; rules keep their order because the last match wins.
+func parseCodeOwners(content string) ([]CodeOwnerRule, error) {
+	rules := []CodeOwnerRule{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 && (i == 0 || line[i-1] != '\\') {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		pattern := strings.ReplaceAll(fields[0], `\#`, "#")
+		if _, err := codeOwnerPatternRegexp(pattern); err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern %q", lineNumber, pattern)
+		}
+		rules = append(rules, CodeOwnerRule{
+			Position: len(rules) + 1,
+			Pattern:  pattern,
+			Owners:   fields[1:],
+		})
+	}
+	return rules, scanner.Err()
+}
+
+// codeOwnerPatternRegexp translates a CODEOWNERS (gitignore-style) pattern. A pattern
+// with a leading or inner slash is anchored at the repository root, otherwise it
+// matches at any depth; a pattern naming a directory matches everything below it.
+func codeOwnerPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	p := pattern
+	dirOnly := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	var expr strings.Builder
+	if anchored {
+		expr.WriteString("^")
+	} else {
+		expr.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case p[i] == '*':
+			expr.WriteString("[^/]*")
+		case p[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(p[i])))
+		}
+	}
+	// As on GitHub, docs/* matches only files directly in docs while docs matches the whole tree
+	lastSegment := p[strings.LastIndex(p, "/")+1:]
+	switch {
+	case dirOnly:
+		expr.WriteString("/.*$")
+	case strings.Contains(lastSegment, "*"):
+		expr.WriteString("$")
+	default:
+		expr.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(expr.String())
+}
+
+// matchCodeOwners finds the owners of the changed files. Each file is owned by the
+// last rule matching it; groups expands @group owners to their members and logins maps
+// @login owners to user ids.
+func matchCodeOwners(rules []CodeOwnerRule, groups map[string][]string, logins map[string]string, files []string) (map[string]bool, []CodeOwnerRule) {
+	owners := map[string]bool{}
+	matched := []CodeOwnerRule{}
+	seen := map[int]bool{}
+
+	compiled := make([]*regexp.Regexp, len(rules))
+	for i, rule := range rules {
+		compiled[i], _ = codeOwnerPatternRegexp(rule.Pattern)
+	}
+
+	for _, file := range files {
+		file = strings.TrimPrefix(file, "/")
+		for i := len(rules) - 1; i >= 0; i-- {
+			if compiled[i] == nil || !compiled[i].MatchString(file) {
+				continue
+			}
+			if !seen[rules[i].Position] {
+				seen[rules[i].Position] = true
+				matched = append(matched, rules[i])
+			}
+			for _, owner := range rules[i].Owners {
+				for _, userID := range expandOwner(owner, groups, logins) {
+					owners[userID] = true
+				}
+			}
+			break
+		}
+	}
+	return owners, matched
+}
+
+// expandOwner resolves one owner: a group first, then a linked forge login for an
+// @owner without an org, and otherwise the name itself as a user_id
+func expandOwner(owner string, groups map[string][]string, logins map[string]string) []string {
+	name := strings.TrimPrefix(owner, "@")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if members, ok := groups[name]; ok {
+		return members
+	}
+	if userID, ok := logins[name]; ok && strings.HasPrefix(owner, "@") && !strings.Contains(owner, "/") {
+		return []string{userID}
+	}
+	return []string{name}
+}
+
+// codeOwnersFor resolves the code owners of files from the team's rules and groups
+func codeOwnersFor(teamName string, files []string) (map[string]bool, []CodeOwnerRule, error) {
+	rules, err := loadCodeOwnerRules(teamName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rules) == 0 {
+		return map[string]bool{}, []CodeOwnerRule{}, nil
+	}
+	groups, err := loadTeamGroups(teamName)
+	if err != nil {
+		return nil, nil, err
+	}
+	logins, err := loadForgeLogins()
+	if err != nil {
+		return nil, nil, err
+	}
+	owners, matched := matchCodeOwners(rules, groups, logins, files)
+	return owners, matched, nil
+}
+
+func loadCodeOwnerRules(teamName string) ([]CodeOwnerRule, error) {
+	rows, err := db.Query("SELECT position, pattern, owners FROM code_owner_rules WHERE team_name = $1 ORDER BY position", teamName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	rules := []CodeOwnerRule{}
+	for rows.Next() {
+		var rule CodeOwnerRule
+		if err := rows.Scan(&rule.Position, &rule.Pattern, pq.Array(&rule.Owners)); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func loadTeamGroups(teamName string) (map[string][]string, error) {
+	rows, err := db.Query("SELECT group_name, user_id FROM team_groups WHERE team_name = $1 ORDER BY group_name, user_id", teamName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	groups := map[string][]string{}
+	for rows.Next() {
+		var groupName, userID string
+		if err := rows.Scan(&groupName, &userID); err != nil {
+			return nil, err
+		}
+		groups[groupName] = append(groups[groupName], userID)
+	}
+	return groups, rows.Err()
+}
+
+// loadForgeLogins maps linked forge logins to user ids. A login linked on both forges
+// resolves to its GitHub account.
+func loadForgeLogins() (map[string]string, error) {
+	rows, err := db.Query("SELECT login, user_id FROM forge_accounts ORDER BY forge, login")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	logins := map[string]string{}
+	for rows.Next() {
+		var login, userID string
+		if err := rows.Scan(&login, &userID); err != nil {
+			return nil, err
+		}
+		if _, ok := logins[login]; !ok {
+			logins[login] = userID
+		}
+	}
+	return logins, rows.Err()
+}
+
+func teamExists(teamName string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM teams WHERE team_name = $1)", teamName).Scan(&exists)
+	return exists, err
+}
+
+// codeOwnersUploadHandler replaces a team's rules, either from a CODEOWNERS file in
+// content or from an explicit rules list
+func codeOwnersUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TeamName string          `json:"team_name"`
+		Content  string          `json:"content"`
+		Rules    []CodeOwnerRule `json:"rules"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rules := req.Rules
+	if req.Content != "" {
+		if len(req.Rules) > 0 {
+			http.Error(w, "content and rules are mutually exclusive", http.StatusBadRequest)
+			return
+		}
+		var err error
+		rules, err = parseCodeOwners(req.Content)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if rules == nil {
+		rules = []CodeOwnerRule{}
+	}
+	for i := range rules {
+		if _, err := codeOwnerPatternRegexp(rules[i].Pattern); err != nil {
+			http.Error(w, fmt.Sprintf("invalid pattern %q", rules[i].Pattern), http.StatusBadRequest)
+			return
+		}
+		rules[i].Position = i + 1
+		if rules[i].Owners == nil {
+			rules[i].Owners = []string{}
+		}
+	}
+
+	exists, err := teamExists(req.TeamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "team not found")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	if _, err := tx.Exec("DELETE FROM code_owner_rules WHERE team_name = $1", req.TeamName); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, rule := range rules {
+		_, err := tx.Exec("INSERT INTO code_owner_rules (team_name, position, pattern, owners) VALUES ($1, $2, $3, $4)",
+			req.TeamName, rule.Position, rule.Pattern, pq.Array(rule.Owners))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"team_name": req.TeamName,
+		"rules":     rules,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func codeOwnersListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamName := r.URL.Query().Get("team_name")
+	if teamName == "" {
+		http.Error(w, "team_name is required", http.StatusBadRequest)
+		return
+	}
+
+	rules, err := loadCodeOwnerRules(teamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	groups, err := loadTeamGroups(teamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"team_name": teamName,
+		"rules":     rules,
+		"groups":    groups,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// teamGroupSetHandler replaces the members of a team group; an empty list removes the group
+func teamGroupSetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TeamName  string   `json:"team_name"`
+		GroupName string   `json:"group_name"`
+		UserIDs   []string `json:"user_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.GroupName = strings.TrimPrefix(req.GroupName, "@")
+	if req.GroupName == "" {
+		http.Error(w, "group_name is required", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := teamExists(req.TeamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "team not found")
+		return
+	}
+
+	var members int
+	err = db.QueryRow("SELECT COUNT(*) FROM users WHERE team_name = $1 AND user_id = ANY($2)", req.TeamName, pq.Array(req.UserIDs)).Scan(&members)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if members != len(uniqueStrings(req.UserIDs)) {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "every group member must belong to the team")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	if _, err := tx.Exec("DELETE FROM team_groups WHERE team_name = $1 AND group_name = $2", req.TeamName, req.GroupName); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, userID := range uniqueStrings(req.UserIDs) {
+		_, err := tx.Exec("INSERT INTO team_groups (team_name, group_name, user_id) VALUES ($1, $2, $3)", req.TeamName, req.GroupName, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"team_name":  req.TeamName,
+		"group_name": req.GroupName,
+		"user_ids":   uniqueStrings(req.UserIDs),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// uniqueStrings drops duplicates, keeping the first occurrence
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCodeOwnerPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*", "any/file.txt", true},
+		{"*.go", "main.go", true},
+		{"*.go", "internal/db/store.go", true},
+		{"*.go", "main.gox", false},
+		{"/build/", "build/logs/out.txt", true},
+		{"/build/", "src/build/out.txt", false},
+		{"docs/", "src/docs/intro.md", true},
+		{"apps/", "apps/web/index.js", true},
+		{"docs/*", "docs/intro.md", true},
+		{"docs/*", "docs/guides/setup.md", false},
+		{"/scripts", "scripts/deploy.sh", true},
+		{"**/migrations", "db/sql/migrations/001.sql", true},
+		{"src/**/handler.go", "src/handler.go", true},
+		{"src/**/handler.go", "src/api/v1/handler.go", true},
+		{"/src/api/**", "src/api/v1/users.go", true},
+		{"/src/api/**", "src/apis/users.go", false},
+		{"README?.md", "README1.md", true},
+	}
+
+	for _, tt := range tests {
+		re, err := codeOwnerPatternRegexp(tt.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("%q against %q: expected %v, got %v", tt.pattern, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestParseCodeOwners(t *testing.T) {
+	content := `# Default owners
+*       @backend-core
+
+[Database]
+/migrations/   u3 @acme/dba   # schema changes
+docs/\#drafts  u4
+/legacy/
+`
+	rules, err := parseCodeOwners(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 4 {
+		t.Fatalf("Expected 4 rules, got %+v", rules)
+	}
+	if rules[1].Pattern != "/migrations/" || len(rules[1].Owners) != 2 || rules[1].Owners[1] != "@acme/dba" {
+		t.Errorf("Unexpected rule %+v", rules[1])
+	}
+	if rules[2].Pattern != "docs/#drafts" {
+		t.Errorf("Expected escaped # to be kept, got %q", rules[2].Pattern)
+	}
+	if rules[3].Position != 4 || len(rules[3].Owners) != 0 {
+		t.Errorf("Expected ownerless rule at position 4, got %+v", rules[3])
+	}
+}
+
+func TestMatchCodeOwnersLastRuleWins(t *testing.T) {
+	rules := []CodeOwnerRule{
+		{Position: 1, Pattern: "*", Owners: []string{"u2"}},
+		{Position: 2, Pattern: "/migrations/", Owners: []string{"@acme/dba"}},
+	}
+	groups := map[string][]string{"dba": {"u3", "u4"}}
+
+	owners, matched := matchCodeOwners(rules, groups, nil, []string{"migrations/001_init.sql"})
+	if len(owners) != 2 || !owners["u3"] || !owners["u4"] {
+		t.Errorf("Expected dba group members, got %v", owners)
+	}
+	if len(matched) != 1 || matched[0].Position != 2 {
+		t.Errorf("Expected only the migrations rule, got %+v", matched)
+	}
+
+	owners, matched = matchCodeOwners(rules, groups, nil, []string{"main.go", "migrations/002.sql"})
+	if len(owners) != 3 || len(matched) != 2 {
+		t.Errorf("Expected both rules to match, got %v %+v", owners, matched)
+	}
+}
+
+func TestMatchCodeOwnersResolvesLogins(t *testing.T) {
+	rules := []CodeOwnerRule{{Position: 1, Pattern: "*.go", Owners: []string{"@bob-gh", "@carol", "u5"}}}
+	logins := map[string]string{"bob-gh": "u2", "u5": "u9"}
+
+	owners, _ := matchCodeOwners(rules, nil, logins, []string{"main.go"})
+	// Unlinked @carol stays a user_id, and a bare owner is never taken for a login
+	if len(owners) != 3 || !owners["u2"] || !owners["carol"] || !owners["u5"] {
+		t.Errorf("Expected u2, carol and u5, got %v", owners)
+	}
+}
+
+func TestCreatePrefersCodeOwners(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u4', 'Dave', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO team_groups (team_name, group_name, user_id) VALUES ('backend', 'dba', 'u4')")
+	_, _ = testDB.Exec("INSERT INTO code_owner_rules (team_name, position, pattern, owners) VALUES ('backend', 1, '/migrations/', '{@dba}')")
+
+	pr, report, err := createPullRequest(PullRequestCreateRequest{
+		PullRequestID:   "pr-1001",
+		PullRequestName: "Add index",
+		AuthorID:        "u1",
+		ChangedFiles:    []string{"migrations/003_index.sql"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pr.ReviewerSlots) != 2 || pr.ReviewerSlots[0].UserID != "u4" {
+		t.Errorf("Expected code owner u4 in the first slot, got %+v", pr.ReviewerSlots)
+	}
+	if len(report.MatchedRules) != 1 || report.MatchedRules[0].Pattern != "/migrations/" {
+		t.Errorf("Expected the migrations rule in the report, got %+v", report.MatchedRules)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Constraint kinds
+const (
+	// ConstraintNeverPair forbids reviewer_id from reviewing author_id's PRs, and the
+	// reverse as well when bidirectional
+	ConstraintNeverPair = "never_pair"
+	// ConstraintAvoidRepeatPair makes team_name avoid giving an author the same two
+	// reviewers as on their previous PR
+	ConstraintAvoidRepeatPair = "avoid_repeat_pair"
+)
+
+// reasonAvoidedRepeatPair prefixes the reason of a reviewer picked to break a repeated pair
+const reasonAvoidedRepeatPair = "constraint: avoided repeating the previous reviewer pair"
+
+// notPairedCondition is true for rows of users who may review PRs of the author bound
+// to authorParam. Like notAbsentCondition it references users.user_id.
+func notPairedCondition(authorParam string) string {
+	return `NOT EXISTS (
+	SELECT 1 FROM review_constraints c
+	WHERE c.kind = 'never_pair' AND (
+		(c.author_id = ` + authorParam + ` AND c.reviewer_id = users.user_id)
+		OR (c.bidirectional AND c.reviewer_id = ` + authorParam + ` AND c.author_id = users.user_id)
+	)
+)`
+}
+
+// ReviewConstraint is a pairing rule enforced during reviewer selection
+type ReviewConstraint struct {
+	ID            int64  `json:"id"`
+	Kind          string `json:"kind"`
+	AuthorID      string `json:"author_id,omitempty"`
+	ReviewerID    string `json:"reviewer_id,omitempty"`
+	Bidirectional bool   `json:"bidirectional"`
+	TeamName      string `json:"team_name,omitempty"`
+	Reason        string `json:"reason"`
+	CreatedAt     string `json:"created_at"`
+}
+
+func (c ReviewConstraint) validate() string {
+	switch c.Kind {
+	case ConstraintNeverPair:
+		if c.AuthorID == "" || c.ReviewerID == "" {
+			return "author_id and reviewer_id are required for never_pair"
+		}
+		if c.AuthorID == c.ReviewerID {
+			return "author_id and reviewer_id must differ"
+		}
+		if c.TeamName != "" {
+			return "team_name is not used by never_pair"
+		}
+	case ConstraintAvoidRepeatPair:
+		if c.TeamName == "" {
+			return "team_name is required for avoid_repeat_pair"
+		}
+		if c.AuthorID != "" || c.ReviewerID != "" {
+			return "author_id and reviewer_id are not used by avoid_repeat_pair"
+		}
+	default:
+		return "kind must be never_pair or avoid_repeat_pair"
+	}
+	return ""
+}
+
+const constraintColumns = "id, kind, COALESCE(author_id, ''), COALESCE(reviewer_id, ''), bidirectional, COALESCE(team_name, ''), reason, created_at"
+
+func scanConstraint(row interface{ Scan(...interface{}) error }) (ReviewConstraint, error) {
+	var c ReviewConstraint
+	var createdAt time.Time
+	err := row.Scan(&c.ID, &c.Kind, &c.AuthorID, &c.ReviewerID, &c.Bidirectional, &c.TeamName, &c.Reason, &createdAt)
+	c.CreatedAt = createdAt.Format(time.RFC3339)
+	return c, err
+}
+
+// previousReviewerPair returns the reviewers of the author's latest PR when it had
+// exactly two and the author's team avoids repeating pairs
+func previousReviewerPair(teamName, authorID string) ([]string, error) {
+	var enabled bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM review_constraints WHERE kind = 'avoid_repeat_pair' AND team_name = $1)", teamName).Scan(&enabled)
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	var latest string
+	err = db.QueryRow(`
+		SELECT pull_request_id FROM pull_requests
+		WHERE author_id = $1
+		ORDER BY created_at DESC, pull_request_id DESC
+		LIMIT 1
+	`, authorID).Scan(&latest)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pair := getCurrentReviewers(db, latest)
+	if len(pair) != 2 {
+		return nil, nil
+	}
+	return pair, nil
+}
+
+// sameReviewers reports whether the slots hold exactly the given reviewers
+func sameReviewers(slots []ReviewerSlot, userIDs []string) bool {
+	if len(userIDs) == 0 || len(slots) != len(userIDs) {
+		return false
+	}
+	wanted := map[string]bool{}
+	for _, userID := range userIDs {
+		wanted[userID] = true
+	}
+	for _, slot := range slots {
+		if !wanted[slot.UserID] {
+			return false
+		}
+	}
+	return true
+}
+
+func constraintAddHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ReviewConstraint
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if msg, err := constraintTargetsExist(req); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if msg != "" {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", msg)
+		return
+	}
+
+	constraint, err := scanConstraint(db.QueryRow(`
+		INSERT INTO review_constraints (kind, author_id, reviewer_id, bidirectional, team_name, reason)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, NULLIF($5, ''), $6)
+		RETURNING `+constraintColumns,
+		req.Kind, req.AuthorID, req.ReviewerID, req.Bidirectional, req.TeamName, req.Reason))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"constraint": constraint}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// constraintTargetsExist returns a NOT_FOUND message when a referenced user or team is missing
+func constraintTargetsExist(c ReviewConstraint) (string, error) {
+	if c.Kind == ConstraintAvoidRepeatPair {
+		exists, err := teamExists(c.TeamName)
+		if err != nil || exists {
+			return "", err
+		}
+		return "team not found", nil
+	}
+
+	var found int
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE user_id IN ($1, $2)", c.AuthorID, c.ReviewerID).Scan(&found)
+	if err != nil || found == 2 {
+		return "", err
+	}
+	return "user not found", nil
+}
+
+// constraintListHandler lists constraints, optionally those touching user_id or team_name
+func constraintListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	teamName := r.URL.Query().Get("team_name")
+
+	rows, err := db.Query(`
+		SELECT `+constraintColumns+` FROM review_constraints
+		WHERE ($1 = '' OR author_id = $1 OR reviewer_id = $1)
+			AND ($2 = '' OR team_name = $2)
+		ORDER BY id
+	`, userID, teamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	constraints := []ReviewConstraint{}
+	for rows.Next() {
+		constraint, err := scanConstraint(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		constraints = append(constraints, constraint)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"constraints": constraints}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func constraintUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ReviewConstraint
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if msg, err := constraintTargetsExist(req); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if msg != "" {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", msg)
+		return
+	}
+
+	constraint, err := scanConstraint(db.QueryRow(`
+		UPDATE review_constraints
+		SET kind = $2, author_id = NULLIF($3, ''), reviewer_id = NULLIF($4, ''), bidirectional = $5,
+			team_name = NULLIF($6, ''), reason = $7
+		WHERE id = $1
+		RETURNING `+constraintColumns,
+		req.ID, req.Kind, req.AuthorID, req.ReviewerID, req.Bidirectional, req.TeamName, req.Reason))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendError(w, http.StatusNotFound, "NOT_FOUND", "constraint not found")
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"constraint": constraint}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func constraintDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM review_constraints WHERE id = $1", req.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "constraint not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"deleted": req.ID}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
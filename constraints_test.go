@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConstraintValidate(t *testing.T) {
+	tests := []struct {
+		constraint ReviewConstraint
+		valid      bool
+	}{
+		{ReviewConstraint{Kind: ConstraintNeverPair, AuthorID: "u1", ReviewerID: "u2"}, true},
+		{ReviewConstraint{Kind: ConstraintNeverPair, AuthorID: "u1", ReviewerID: "u1"}, false},
+		{ReviewConstraint{Kind: ConstraintNeverPair, AuthorID: "u1"}, false},
+		{ReviewConstraint{Kind: ConstraintAvoidRepeatPair, TeamName: "backend"}, true},
+		{ReviewConstraint{Kind: ConstraintAvoidRepeatPair, TeamName: "backend", AuthorID: "u1"}, false},
+		{ReviewConstraint{Kind: "sometimes_pair"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.constraint.validate() == ""; got != tt.valid {
+			t.Errorf("%+v: expected valid=%v", tt.constraint, tt.valid)
+		}
+	}
+}
+
+func TestSameReviewers(t *testing.T) {
+	slots := []ReviewerSlot{{UserID: "u3"}, {UserID: "u2"}}
+	if !sameReviewers(slots, []string{"u2", "u3"}) {
+		t.Error("Expected the same pair in any order to match")
+	}
+	if sameReviewers(slots, []string{"u2", "u4"}) || sameReviewers(nil, nil) {
+		t.Error("Expected different or missing pairs not to match")
+	}
+}
+
+func TestNeverPairExcludesReviewer(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO review_constraints (kind, author_id, reviewer_id, bidirectional) VALUES ('never_pair', 'u2', 'u1', true)")
+
+	pr, _, err := createPullRequest(PullRequestCreateRequest{PullRequestID: "pr-1001", PullRequestName: "Add feature", AuthorID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u3" {
+		t.Errorf("Expected the bidirectional constraint to exclude u2, got %v", pr.AssignedReviewers)
+	}
+
+	if members := getActiveTeamMembersExcluding(db, "backend", "u1", []string{"u3"}); len(members) != 1 || members[0] != "u1" {
+		t.Errorf("Expected only u1 to remain, got %v", members)
+	}
+}
+
+func TestAvoidRepeatPair(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u4', 'Dave', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO review_constraints (kind, team_name) VALUES ('avoid_repeat_pair', 'backend')")
+
+	for i := 0; i < 10; i++ {
+		previous := []string{}
+		if i > 0 {
+			previous = getCurrentReviewers(db, fmt.Sprintf("pr-%d", 1000+i-1))
+		}
+		pr, _, err := createPullRequest(PullRequestCreateRequest{PullRequestID: fmt.Sprintf("pr-%d", 1000+i), PullRequestName: "Change", AuthorID: "u1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(previous) == 2 && sameReviewers(pr.ReviewerSlots, previous) {
+			t.Fatalf("PR %d repeated the previous pair %v", i, previous)
+		}
+	}
+}
+
+func TestAvoidRepeatPairKeepsSeniorReviewer(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, min_reviewer_seniority) VALUES ('backend', 'senior')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, seniority) VALUES ('u2', 'Bob', 'backend', true, 'lead')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, seniority) VALUES ('u3', 'Charlie', 'backend', true, 'junior')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, seniority) VALUES ('u4', 'Dave', 'backend', true, 'junior')")
+	_, _ = testDB.Exec("INSERT INTO review_constraints (kind, team_name) VALUES ('avoid_repeat_pair', 'backend')")
+
+	// u2 is the only senior, so the pair is broken up on the junior slot
+	for i := 0; i < 6; i++ {
+		pr, _, err := createPullRequest(PullRequestCreateRequest{PullRequestID: fmt.Sprintf("pr-%d", 1000+i), PullRequestName: "Change", AuthorID: "u1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !containsString(pr.AssignedReviewers, "u2") {
+			t.Fatalf("PR %d lost the senior reviewer: %v", i, pr.AssignedReviewers)
+		}
+	}
+}
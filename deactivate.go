@@ -0,0 +1,370 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// deactivationFilter selects the team members a /team/deactivate affects by attribute.
+// Empty fields match everyone.
+type deactivationFilter struct {
+	Seniority string `json:"seniority"`
+	// Tags must all be present on the user
+	Tags []string `json:"tags"`
+}
+
+// checkTeamMembers returns an apiError naming the users that do not exist or belong to
+// another team than teamName
+func checkTeamMembers(teamName string, userIDs []string) error {
+	rows, err := db.Query("SELECT user_id, team_name FROM users WHERE user_id = ANY($1)", pq.Array(userIDs))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	teams := map[string]string{}
+	for rows.Next() {
+		var userID, userTeam string
+		if err := rows.Scan(&userID, &userTeam); err != nil {
+			return err
+		}
+		teams[userID] = userTeam
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var missing, foreign []string
+	for _, userID := range uniqueStrings(userIDs) {
+		userTeam, ok := teams[userID]
+		if !ok {
+			missing = append(missing, userID)
+		} else if userTeam != teamName {
+			foreign = append(foreign, userID)
+		}
+	}
+	if len(missing) > 0 {
+		return &apiError{http.StatusNotFound, "NOT_FOUND", "users not found: " + strings.Join(missing, ", "), ""}
+	}
+	if len(foreign) > 0 {
+		return &apiError{http.StatusConflict, "WRONG_TEAM", "users not in team " + teamName + ": " + strings.Join(foreign, ", "), ""}
+	}
+	return nil
+}
+
+// reasonDeactivationReplacement is recorded for reviewers taking over from a deactivated user
+const reasonDeactivationReplacement = "replaced a deactivated reviewer; least loaded team member"
+
+// Reassignment is a review moved from a deactivated user to someone else
+type Reassignment struct {
+	PRID        string `json:"pr_id"`
+	OldReviewer string `json:"old_reviewer"`
+	NewReviewer string `json:"new_reviewer"`
+}
+
+// reviewToReassign is an OPEN review held by a user being deactivated
+type reviewToReassign struct {
+	PRID     string
+	AuthorID string
+	UserID   string
+	// MinSeniority is the min_reviewer_seniority of the author's team, or empty
+	MinSeniority string
+}
+
+// reassignmentCandidate is an active team member who may take over reviews
+type reassignmentCandidate struct {
+	UserID string
+	// Load is the number of OPEN reviews the user holds
+	Load int
+	// Cap is the user's open review cap, or -1 when uncapped
+	Cap int
+}
+
+// planReassignments hands every review to the eligible candidate with the fewest open
+// reviews, so a deactivation spreads its reviews evenly instead of piling them onto
+// one person. Candidates already reviewing the PR, authoring it, at their cap or barred
+// by paired are not eligible. When the leaving reviewer is the only one on the PR who
+// meets the author team's seniority rule, only candidates meeting it are eligible, as in
+// /pullRequest/reassign. Reviews nobody can take are returned as failed.
+// reviewers holds the current reviewers of every PR and is updated with the plan;
+// levels maps users to their seniority.
+func planReassignments(reviews []reviewToReassign, reviewers map[string][]string, candidates []reassignmentCandidate, levels map[string]string, paired func(authorID, reviewerID string) bool) (planned []Reassignment, failed []reviewToReassign) {
+	loads := make([]reassignmentCandidate, len(candidates))
+	copy(loads, candidates)
+
+	for _, review := range reviews {
+		current := reviewers[review.PRID]
+		needsSenior := review.MinSeniority != "" && keepsSeniorityRule(review, current, levels)
+		best := -1
+		for i, c := range loads {
+			if c.UserID == review.AuthorID || (c.Cap >= 0 && c.Load >= c.Cap) || containsString(current, c.UserID) {
+				continue
+			}
+			if needsSenior && len(atLeastSeniority([]string{c.UserID}, levels, review.MinSeniority)) == 0 {
+				continue
+			}
+			if best >= 0 && c.Load >= loads[best].Load {
+				continue
+			}
+			if paired(review.AuthorID, c.UserID) {
+				continue
+			}
+			best = i
+		}
+
+		if best < 0 {
+			failed = append(failed, review)
+			continue
+		}
+		loads[best].Load++
+		newReviewer := loads[best].UserID
+		planned = append(planned, Reassignment{PRID: review.PRID, OldReviewer: review.UserID, NewReviewer: newReviewer})
+
+		updated := make([]string, 0, len(current))
+		for _, userID := range current {
+			if userID != review.UserID {
+				updated = append(updated, userID)
+			}
+		}
+		reviewers[review.PRID] = append(updated, newReviewer)
+	}
+	return planned, failed
+}
+
+// keepsSeniorityRule reports whether review.UserID is the only reviewer in current who
+// meets review.MinSeniority
+func keepsSeniorityRule(review reviewToReassign, current []string, levels map[string]string) bool {
+	var others []string
+	for _, userID := range current {
+		if userID != review.UserID {
+			others = append(others, userID)
+		}
+	}
+	return len(atLeastSeniority([]string{review.UserID}, levels, review.MinSeniority)) > 0 &&
+		len(atLeastSeniority(others, levels, review.MinSeniority)) == 0
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// reassignDeactivatedReviews moves the OPEN reviews of userIDs, who must already be
+// deactivated in tx, to the remaining active members of teamName. It runs a constant
+// number of statements however many reviews move. Reviews nobody can take are dropped.
+// Unlike create and reassign, it does not borrow from fallback teams and ignores
+// avoid_repeat_pair.
+func reassignDeactivatedReviews(tx dbExecutor, teamName string, userIDs []string) ([]Reassignment, []reviewToReassign, error) {
+	reviews, reviewers, err := loadReviewsToReassign(tx, userIDs)
+	if err != nil || len(reviews) == 0 {
+		return nil, nil, err
+	}
+	candidates, err := loadReassignmentCandidates(tx, teamName)
+	if err != nil {
+		return nil, nil, err
+	}
+	paired, err := loadNeverPairs(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var userIDsToRank []string
+	for _, c := range candidates {
+		userIDsToRank = append(userIDsToRank, c.UserID)
+	}
+	for _, current := range reviewers {
+		userIDsToRank = append(userIDsToRank, current...)
+	}
+	levels := loadSeniority(tx, uniqueStrings(userIDsToRank))
+
+	planned, failed := planReassignments(reviews, reviewers, candidates, levels, paired)
+
+	authors := map[string]string{}
+	for _, review := range reviews {
+		authors[review.PRID] = review.AuthorID
+	}
+	if err := applyReassignments(tx, planned, authors, reasonDeactivationReplacement); err != nil {
+		return nil, nil, err
+	}
+
+	if len(failed) == 0 {
+		return planned, nil, nil
+	}
+
+	// Drop the reviews nobody could take
+	prIDs := make([]string, len(failed))
+	failedUserIDs := make([]string, len(failed))
+	events := make([]pendingEvent, len(failed))
+	for i, review := range failed {
+		prIDs[i], failedUserIDs[i] = review.PRID, review.UserID
+		events[i] = pendingEvent{EventReviewerUnassigned, []string{review.UserID}, EventPayload{
+			PullRequestID: review.PRID,
+			AuthorID:      review.AuthorID,
+			UserID:        review.UserID,
+		}}
+	}
+	if err := archiveReviewers(tx, prIDs, failedUserIDs); err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM pr_reviewers r
+		USING unnest($1::text[], $2::text[]) AS p(pull_request_id, user_id)
+		WHERE r.pull_request_id = p.pull_request_id AND r.user_id = p.user_id
+	`, pq.Array(prIDs), pq.Array(failedUserIDs))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := recordEvents(tx, events); err != nil {
+		return nil, nil, err
+	}
+	return planned, failed, nil
+}
+
+// applyReassignments moves the reviews in a single statement and records a
+// reviewer.reassigned event for each. authors maps PR IDs to their authors.
+func applyReassignments(tx dbExecutor, moves []Reassignment, authors map[string]string, reason string) error {
+	if len(moves) == 0 {
+		return nil
+	}
+
+	prIDs := make([]string, len(moves))
+	oldUserIDs := make([]string, len(moves))
+	newUserIDs := make([]string, len(moves))
+	events := make([]pendingEvent, len(moves))
+	for i, move := range moves {
+		prIDs[i], oldUserIDs[i], newUserIDs[i] = move.PRID, move.OldReviewer, move.NewReviewer
+		events[i] = pendingEvent{EventReviewerReassigned, []string{move.OldReviewer, move.NewReviewer}, EventPayload{
+			PullRequestID: move.PRID,
+			AuthorID:      authors[move.PRID],
+			OldUserID:     move.OldReviewer,
+			NewUserID:     move.NewReviewer,
+		}}
+	}
+
+	if err := archiveReviewers(tx, prIDs, oldUserIDs); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		UPDATE pr_reviewers r
+		SET user_id = p.new_user_id, assignment_reason = $4, fallback_team = NULL, `+reviewerResetColumns+`
+		FROM unnest($1::text[], $2::text[], $3::text[]) AS p(pull_request_id, old_user_id, new_user_id)
+		WHERE r.pull_request_id = p.pull_request_id AND r.user_id = p.old_user_id
+	`, pq.Array(prIDs), pq.Array(oldUserIDs), pq.Array(newUserIDs), reason)
+	if err != nil {
+		return err
+	}
+	return recordEvents(tx, events)
+}
+
+// loadReviewsToReassign returns the OPEN reviews held by userIDs, ordered by PR, and
+// the current reviewers of those PRs
+func loadReviewsToReassign(q dbExecutor, userIDs []string) ([]reviewToReassign, map[string][]string, error) {
+	rows, err := q.Query(`
+		SELECT r.pull_request_id, pr.author_id, r.user_id,
+			ARRAY(SELECT o.user_id FROM pr_reviewers o WHERE o.pull_request_id = r.pull_request_id),
+			COALESCE(t.min_reviewer_seniority, '')
+		FROM pr_reviewers r
+		JOIN pull_requests pr ON pr.pull_request_id = r.pull_request_id
+		JOIN users a ON a.user_id = pr.author_id
+		JOIN teams t ON t.team_name = a.team_name
+		WHERE r.user_id = ANY($1) AND pr.status = 'OPEN'
+		ORDER BY r.pull_request_id, r.user_id
+	`, pq.Array(userIDs))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	var reviews []reviewToReassign
+	reviewers := map[string][]string{}
+	for rows.Next() {
+		var review reviewToReassign
+		var current []string
+		if err := rows.Scan(&review.PRID, &review.AuthorID, &review.UserID, pq.Array(&current), &review.MinSeniority); err != nil {
+			return nil, nil, err
+		}
+		reviews = append(reviews, review)
+		reviewers[review.PRID] = current
+	}
+	return reviews, reviewers, rows.Err()
+}
+
+// loadReassignmentCandidates returns the active, present members of teamName with their
+// open review load and cap
+func loadReassignmentCandidates(q dbExecutor, teamName string) ([]reassignmentCandidate, error) {
+	rows, err := q.Query(`
+		SELECT users.user_id, COALESCE(users.max_open_reviews, t.default_max_open_reviews, -1),
+			(SELECT COUNT(*) FROM pr_reviewers r
+			JOIN pull_requests pr ON pr.pull_request_id = r.pull_request_id
+			WHERE r.user_id = users.user_id AND pr.status = 'OPEN')
+		FROM users
+		JOIN teams t ON t.team_name = users.team_name
+		WHERE users.team_name = $1 AND users.is_active = true AND `+notAbsentCondition+`
+		ORDER BY users.user_id
+	`, teamName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	var candidates []reassignmentCandidate
+	for rows.Next() {
+		var c reassignmentCandidate
+		if err := rows.Scan(&c.UserID, &c.Cap, &c.Load); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// loadNeverPairs returns whether a never_pair constraint bars reviewerID from authorID's PRs
+func loadNeverPairs(q dbExecutor) (func(authorID, reviewerID string) bool, error) {
+	rows, err := q.Query("SELECT author_id, reviewer_id, bidirectional FROM review_constraints WHERE kind = 'never_pair'")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	barred := map[[2]string]bool{}
+	for rows.Next() {
+		var authorID, reviewerID string
+		var bidirectional bool
+		if err := rows.Scan(&authorID, &reviewerID, &bidirectional); err != nil {
+			return nil, err
+		}
+		barred[[2]string{authorID, reviewerID}] = true
+		if bidirectional {
+			barred[[2]string{reviewerID, authorID}] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return func(authorID, reviewerID string) bool {
+		return barred[[2]string{authorID, reviewerID}]
+	}, nil
+}
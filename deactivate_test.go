@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func noPairs(authorID, reviewerID string) bool { return false }
+
+func TestPlanReassignmentsSpreadsEvenly(t *testing.T) {
+	var reviews []reviewToReassign
+	reviewers := map[string][]string{}
+	for i := 0; i < 9; i++ {
+		prID := fmt.Sprintf("pr-%d", i)
+		reviews = append(reviews, reviewToReassign{PRID: prID, AuthorID: "u1", UserID: "old"})
+		reviewers[prID] = []string{"old"}
+	}
+	candidates := []reassignmentCandidate{{UserID: "u1", Cap: -1}, {UserID: "u2", Load: 2, Cap: -1}, {UserID: "u3", Cap: -1}, {UserID: "u4", Cap: 3}}
+
+	planned, failed := planReassignments(reviews, reviewers, candidates, nil, noPairs)
+	if len(failed) != 0 {
+		t.Fatalf("Expected every review to be reassigned, %d failed", len(failed))
+	}
+
+	received := map[string]int{}
+	for _, move := range planned {
+		received[move.NewReviewer]++
+	}
+	// u1 is the author; u2 starts with 2 reviews, u4 is capped at 3
+	if received["u1"] != 0 || received["u2"] != 2 || received["u3"] != 4 || received["u4"] != 3 {
+		t.Errorf("Expected loads to even out, got %v", received)
+	}
+}
+
+func TestPlanReassignmentsSkipsBarredCandidates(t *testing.T) {
+	reviews := []reviewToReassign{{PRID: "pr-1", AuthorID: "u1", UserID: "old1"}, {PRID: "pr-1", AuthorID: "u1", UserID: "old2"}}
+	reviewers := map[string][]string{"pr-1": {"old1", "old2"}}
+	candidates := []reassignmentCandidate{{UserID: "u2", Cap: -1}, {UserID: "u3", Cap: -1}}
+	paired := func(authorID, reviewerID string) bool { return authorID == "u1" && reviewerID == "u3" }
+
+	planned, failed := planReassignments(reviews, reviewers, candidates, nil, paired)
+	if len(planned) != 1 || planned[0].NewReviewer != "u2" {
+		t.Errorf("Expected u2 to take the first review, got %+v", planned)
+	}
+	// u2 now reviews pr-1 and u3 may not review u1's PRs
+	if len(failed) != 1 || failed[0].UserID != "old2" {
+		t.Errorf("Expected the second review to fail, got %+v", failed)
+	}
+}
+
+func TestPlanReassignmentsKeepsSeniorityRule(t *testing.T) {
+	reviews := []reviewToReassign{
+		{PRID: "pr-1", AuthorID: "u1", UserID: "old", MinSeniority: "senior"},
+		{PRID: "pr-2", AuthorID: "u1", UserID: "old", MinSeniority: "senior"},
+	}
+	// On pr-2 another reviewer already meets the rule
+	reviewers := map[string][]string{"pr-1": {"old", "u5"}, "pr-2": {"old", "u6"}}
+	candidates := []reassignmentCandidate{{UserID: "u2", Cap: -1}, {UserID: "u3", Load: 5, Cap: -1}}
+	levels := map[string]string{"old": "lead", "u2": "junior", "u3": "senior", "u5": "middle", "u6": "senior"}
+
+	planned, failed := planReassignments(reviews, reviewers, candidates, levels, noPairs)
+	if len(failed) != 0 || len(planned) != 2 {
+		t.Fatalf("Expected both reviews to be reassigned, got %+v and failed %+v", planned, failed)
+	}
+	if planned[0].NewReviewer != "u3" || planned[1].NewReviewer != "u2" {
+		t.Errorf("Expected the senior u3 on pr-1 and the least loaded u2 on pr-2, got %+v", planned)
+	}
+
+	// Without a senior candidate the review fails instead of breaking the rule
+	failedReviewers := map[string][]string{"pr-1": {"old", "u5"}}
+	planned, failed = planReassignments(reviews[:1], failedReviewers, candidates[:1], levels, noPairs)
+	if len(planned) != 0 || len(failed) != 1 {
+		t.Errorf("Expected pr-1 to fail, got %+v", planned)
+	}
+}
+
+// BenchmarkPlanReassignments plans the moves for a team with 500 open PRs
+func BenchmarkPlanReassignments(b *testing.B) {
+	var reviews []reviewToReassign
+	reviewers := map[string][]string{}
+	for i := 0; i < 500; i++ {
+		prID := fmt.Sprintf("pr-%d", i)
+		reviews = append(reviews, reviewToReassign{PRID: prID, AuthorID: fmt.Sprintf("author-%d", i%20), UserID: fmt.Sprintf("old-%d", i%10)})
+		reviewers[prID] = []string{fmt.Sprintf("old-%d", i%10), fmt.Sprintf("c-%d", i%40)}
+	}
+	var candidates []reassignmentCandidate
+	for i := 0; i < 40; i++ {
+		candidates = append(candidates, reassignmentCandidate{UserID: fmt.Sprintf("c-%d", i), Load: i % 5, Cap: -1})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		current := make(map[string][]string, len(reviewers))
+		for prID, userIDs := range reviewers {
+			current[prID] = userIDs
+		}
+		planReassignments(reviews, current, candidates, nil, noPairs)
+	}
+}
+
+// seedDeactivationLoad fills the database with a team of 40 members and 300 OPEN PRs
+// and returns a dry run request deactivating half the team
+func seedDeactivationLoad(tb testing.TB, testDB *sql.DB) []byte {
+	tb.Helper()
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	var leaving []string
+	for i := 0; i < 40; i++ {
+		_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ($1, $1, 'backend', true)", fmt.Sprintf("u%d", i))
+		if i%2 == 0 {
+			leaving = append(leaving, fmt.Sprintf("u%d", i))
+		}
+	}
+	for i := 0; i < 300; i++ {
+		prID := fmt.Sprintf("pr-%d", i)
+		_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ($1, $1, $2, 'OPEN')", prID, fmt.Sprintf("u%d", i%40))
+		_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ($1, $2), ($1, $3)", prID, fmt.Sprintf("u%d", (i+1)%40), fmt.Sprintf("u%d", (i+2)%40))
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"team_name": "backend", "user_ids": leaving, "dry_run": true})
+	return body
+}
+
+// BenchmarkTeamDeactivation deactivates half of a 40 member team holding 300 open PRs.
+// Dry runs roll back, so every iteration sees the same data.
+func BenchmarkTeamDeactivation(b *testing.B) {
+	testDB := setupTestDB(b)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	body := seedDeactivationLoad(b, testDB)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		teamDeactivateHandler(w, httptest.NewRequest(http.MethodPost, "/team/deactivate", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			b.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Event types recorded in the event log whenever review assignments change
+const (
+	EventReviewerAssigned    = "reviewer.assigned"
+	EventReviewerReassigned  = "reviewer.reassigned"
+	EventReviewerUnassigned  = "reviewer.unassigned"
+	EventPullRequestMerged   = "pull_request.merged"
+	EventPullRequestClosed   = "pull_request.closed"
+	EventPullRequestReopened = "pull_request.reopened"
+	EventReviewReminder      = "review.reminder"
+	EventReviewEscalated     = "review.escalated"
+)
+
+// eventTypes is the set of event types subscribers may ask for
+var eventTypes = map[string]bool{
+	EventReviewerAssigned:    true,
+	EventReviewerReassigned:  true,
+	EventReviewerUnassigned:  true,
+	EventPullRequestMerged:   true,
+	EventPullRequestClosed:   true,
+	EventPullRequestReopened: true,
+	EventReviewReminder:      true,
+	EventReviewEscalated:     true,
+}
+
+// dbExecutor is implemented by both *sql.DB and *sql.Tx so helpers can run inside a transaction
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// EventPayload is the data attached to an event
+type EventPayload struct {
+	PullRequestID     string   `json:"pull_request_id"`
+	AuthorID          string   `json:"author_id,omitempty"`
+	UserID            string   `json:"user_id,omitempty"`
+	OldUserID         string   `json:"old_user_id,omitempty"`
+	NewUserID         string   `json:"new_user_id,omitempty"`
+	AssignedReviewers []string `json:"assigned_reviewers,omitempty"`
+	Reason            string   `json:"reason,omitempty"`
+}
+
+// Event is an entry of the event log as delivered to subscribers
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt string          `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// recordEvent appends an event to the event log, notifies open review streams, queues
+// a webhook delivery for every subscription interested in it and mirrors reviewer
+// changes to the forge. Recipients are the users the event concerns.
+// Run it in the same transaction as the change so events are never lost or invented.
+func recordEvent(q dbExecutor, eventType string, recipients []string, payload EventPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if recipients == nil {
+		recipients = []string{}
+	}
+
+	var eventID int64
+	err = q.QueryRow(`
+		INSERT INTO events (event_type, pull_request_id, recipients, payload)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, eventType, payload.PullRequestID, pq.Array(recipients), string(data)).Scan(&eventID)
+	if err != nil {
+		return err
+	}
+
+	// Delivered on commit to every replica's review streams
+	if _, err := q.Exec("SELECT pg_notify($1, $2)", eventChannel, strconv.FormatInt(eventID, 10)); err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO webhook_deliveries (subscription_id, event_id)
+		SELECT id, $1 FROM webhook_subscriptions WHERE $2 = ANY(event_types)
+	`, eventID, eventType)
+	if err != nil {
+		return err
+	}
+
+	return enqueueForgeSync(q, eventType, payload)
+}
+
+// pendingEvent is an event waiting to be recorded by recordEvents
+type pendingEvent struct {
+	Type       string
+	Recipients []string
+	Payload    EventPayload
+}
+
+// recordEvents is recordEvent for many events at once. It runs a constant number of
+// statements however many events there are, for bulk changes such as team deactivation.
+func recordEvents(q dbExecutor, events []pendingEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	types := make([]string, len(events))
+	prIDs := make([]string, len(events))
+	recipients := make([]string, len(events))
+	payloads := make([]string, len(events))
+	for i, e := range events {
+		if e.Recipients == nil {
+			e.Recipients = []string{}
+		}
+		recipientData, err := json.Marshal(e.Recipients)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(e.Payload)
+		if err != nil {
+			return err
+		}
+		types[i] = e.Type
+		prIDs[i] = e.Payload.PullRequestID
+		recipients[i] = string(recipientData)
+		payloads[i] = string(data)
+	}
+
+	// Insert the events, notify review streams and queue webhook deliveries in one statement
+	_, err := q.Exec(`
+		WITH inserted AS (
+			INSERT INTO events (event_type, pull_request_id, recipients, payload)
+			SELECT e.event_type, e.pull_request_id, ARRAY(SELECT jsonb_array_elements_text(e.recipients::jsonb)), e.payload::jsonb
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::text[]) WITH ORDINALITY AS e(event_type, pull_request_id, recipients, payload, n)
+			ORDER BY e.n
+			RETURNING id, event_type
+		), deliveries AS (
+			INSERT INTO webhook_deliveries (subscription_id, event_id)
+			SELECT s.id, i.id FROM inserted i
+			JOIN webhook_subscriptions s ON i.event_type = ANY(s.event_types)
+		)
+		SELECT pg_notify($5, i.id::text) FROM inserted i ORDER BY i.id
+	`, pq.Array(types), pq.Array(prIDs), pq.Array(recipients), pq.Array(payloads), eventChannel)
+	if err != nil {
+		return err
+	}
+
+	return enqueueForgeSyncBatch(q, events)
+}
+
+// scanEvent reads the id, event_type, payload and created_at columns into an Event
+func scanEvent(row interface{ Scan(...interface{}) error }) (Event, error) {
+	var event Event
+	var payload string
+	var createdAt time.Time
+	if err := row.Scan(&event.ID, &event.Type, &payload, &createdAt); err != nil {
+		return event, err
+	}
+	event.Data = json.RawMessage(payload)
+	event.CreatedAt = createdAt.Format(time.RFC3339)
+	return event, nil
+}
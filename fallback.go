@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+)
+
+// loadFallbackTeams returns the teams that lend reviewers to teamName, in order of preference
+func loadFallbackTeams(q dbExecutor, teamName string) ([]string, error) {
+	rows, err := q.Query("SELECT fallback_team FROM team_fallbacks WHERE team_name = $1 ORDER BY position", teamName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	teams := []string{}
+	for rows.Next() {
+		var team string
+		if err := rows.Scan(&team); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// fillFromTeamAndFallbacks fills up to count slots from the team's own candidates and,
+// when they run out, from its fallback teams. Candidates listed in exclude are skipped.
+func fillFromTeamAndFallbacks(q dbExecutor, teamName, authorID string, candidates, exclude []string, count int, tiersFor func([]string) []candidateTier) ([]ReviewerSlot, []string, error) {
+	excluded := map[string]bool{}
+	for _, userID := range exclude {
+		excluded[userID] = true
+	}
+	var remaining []string
+	for _, userID := range candidates {
+		if !excluded[userID] {
+			remaining = append(remaining, userID)
+		}
+	}
+
+	slots := fillSlots(tiersFor(remaining), count)
+	if len(slots) >= count {
+		return slots, nil, nil
+	}
+
+	exclude = append([]string{}, exclude...)
+	for _, slot := range slots {
+		exclude = append(exclude, slot.UserID)
+	}
+	fallbackSlots, atCapacity, err := fillFromFallbackTeams(q, teamName, authorID, exclude, count-len(slots), tiersFor)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(slots, fallbackSlots...), atCapacity, nil
+}
+
+// fillFromFallbackTeams fills up to count slots from teamName's fallback teams, exhausting
+// each team before moving on to the next. Fallbacks are not followed transitively.
+// tiersFor orders a team's candidates the same way as for the primary team.
+func fillFromFallbackTeams(q dbExecutor, teamName, authorID string, exclude []string, count int, tiersFor func([]string) []candidateTier) (slots []ReviewerSlot, atCapacity []string, err error) {
+	slots = []ReviewerSlot{}
+	if count <= 0 {
+		return slots, nil, nil
+	}
+
+	fallbackTeams, err := loadFallbackTeams(q, teamName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exclude = append([]string{}, exclude...)
+	for _, fallbackTeam := range fallbackTeams {
+		remaining := count - len(slots)
+		if remaining <= 0 {
+			break
+		}
+
+		candidates, full, err := splitByCapacity(q, getActiveTeamMembersExcluding(q, fallbackTeam, authorID, exclude))
+		if err != nil {
+			return nil, nil, err
+		}
+		atCapacity = append(atCapacity, full...)
+		for _, slot := range fillSlots(tiersFor(candidates), remaining) {
+			slot.FallbackTeam = fallbackTeam
+			slots = append(slots, slot)
+			exclude = append(exclude, slot.UserID)
+		}
+	}
+	return slots, atCapacity, nil
+}
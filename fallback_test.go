@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCreateFallsBackToOtherTeams(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend'), ('platform'), ('infra')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'platform', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'infra', true)")
+	_, _ = testDB.Exec("INSERT INTO team_fallbacks (team_name, position, fallback_team) VALUES ('backend', 1, 'platform'), ('backend', 2, 'infra')")
+
+	pr, report, err := createPullRequest(PullRequestCreateRequest{PullRequestID: "pr-1001", PullRequestName: "Add feature", AuthorID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.UnfilledSlots != 0 {
+		t.Errorf("Expected fallback teams to fill both slots, got %+v", report)
+	}
+	if len(pr.ReviewerSlots) != 2 || pr.ReviewerSlots[0].FallbackTeam != "platform" || pr.ReviewerSlots[1].FallbackTeam != "infra" {
+		t.Errorf("Expected one reviewer from each fallback team in order, got %+v", pr.ReviewerSlots)
+	}
+
+	stored := getPullRequest("pr-1001")
+	for _, slot := range stored.ReviewerSlots {
+		if slot.FallbackTeam == "" {
+			t.Errorf("Expected fallback team to be stored, got %+v", stored.ReviewerSlots)
+		}
+	}
+}
+
+func TestReassignFallsBackToOtherTeams(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend'), ('platform')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'platform', true)")
+	_, _ = testDB.Exec("INSERT INTO team_fallbacks (team_name, position, fallback_team) VALUES ('backend', 1, 'platform')")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Add feature', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1001', 'u2')")
+
+	pr, newReviewerID, err := reassignReviewer(PullRequestReassignRequest{PullRequestID: "pr-1001", OldUserID: "u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if newReviewerID != "u3" {
+		t.Errorf("Expected u3 from the fallback team, got %s", newReviewerID)
+	}
+	if len(pr.ReviewerSlots) != 1 || pr.ReviewerSlots[0].FallbackTeam != "platform" {
+		t.Errorf("Expected the slot to record the fallback team, got %+v", pr.ReviewerSlots)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Forge outbox actions
+const (
+	forgeRequestReviewer = "request"
+	forgeRemoveReviewer  = "remove"
+)
+
+// ForgeClient mirrors reviewer assignments onto the forge's pull request
+type ForgeClient interface {
+	RequestReviewers(ctx context.Context, ref ForgeRef, logins []string) error
+	RemoveReviewer(ctx context.Context, ref ForgeRef, login string) error
+}
+
+// forgeClients holds a client per forge; forges without credentials are absent
+var forgeClients = map[string]ForgeClient{}
+
+// forgeHTTPClient is shared by the GitHub and GitLab clients
+var forgeHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// ForgeAPIError is returned when the forge answers with a non-2xx status
+type ForgeAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ForgeAPIError) Error() string {
+	return fmt.Sprintf("forge responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+// permanent reports whether retrying cannot help, e.g. the login is not a collaborator
+func (e *ForgeAPIError) permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 &&
+		e.StatusCode != http.StatusRequestTimeout && e.StatusCode != http.StatusTooManyRequests
+}
+
+// configureForgeClients creates clients for every forge that has a token configured
+func configureForgeClients() {
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		baseURL := os.Getenv("GITHUB_API_URL")
+		if baseURL == "" {
+			baseURL = "https://api.github.com"
+		}
+		forgeClients[forgeGitHub] = &GitHubClient{BaseURL: baseURL, Token: token}
+	}
+	if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+		baseURL := os.Getenv("GITLAB_API_URL")
+		if baseURL == "" {
+			baseURL = "https://gitlab.com/api/v4"
+		}
+		forgeClients[forgeGitLab] = &GitLabClient{BaseURL: baseURL, Token: token}
+	}
+}
+
+// GitHubClient talks to the GitHub REST API
+type GitHubClient struct {
+	BaseURL string
+	Token   string
+}
+
+// RequestReviewers adds logins to the pull request's requested reviewers
+func (c *GitHubClient) RequestReviewers(ctx context.Context, ref ForgeRef, logins []string) error {
+	return c.reviewers(ctx, http.MethodPost, ref, logins)
+}
+
+// RemoveReviewer withdraws a review request
+func (c *GitHubClient) RemoveReviewer(ctx context.Context, ref ForgeRef, login string) error {
+	return c.reviewers(ctx, http.MethodDelete, ref, []string{login})
+}
+
+func (c *GitHubClient) reviewers(ctx context.Context, method string, ref ForgeRef, logins []string) error {
+	endpoint := fmt.Sprintf("%s/repos/%s/pulls/%d/requested_reviewers", c.BaseURL, ref.Repository, ref.Number)
+	body, err := json.Marshal(map[string][]string{"reviewers": logins})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Content-Type", "application/json")
+
+	return doForgeRequest(req, nil)
+}
+
+// GitLabClient talks to the GitLab REST API. GitLab only accepts the full list of
+// reviewer ids, so every change reads the current list and writes it back.
+type GitLabClient struct {
+	BaseURL string
+	Token   string
+}
+
+// RequestReviewers adds logins to the merge request's reviewers
+func (c *GitLabClient) RequestReviewers(ctx context.Context, ref ForgeRef, logins []string) error {
+	current, err := c.reviewerIDs(ctx, ref)
+	if err != nil {
+		return err
+	}
+	for _, login := range logins {
+		id, err := c.userID(ctx, login)
+		if err != nil {
+			return err
+		}
+		if !containsInt(current, id) {
+			current = append(current, id)
+		}
+	}
+	return c.setReviewerIDs(ctx, ref, current)
+}
+
+// RemoveReviewer drops a login from the merge request's reviewers
+func (c *GitLabClient) RemoveReviewer(ctx context.Context, ref ForgeRef, login string) error {
+	current, err := c.reviewerIDs(ctx, ref)
+	if err != nil {
+		return err
+	}
+	id, err := c.userID(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	remaining := []int{}
+	for _, reviewerID := range current {
+		if reviewerID != id {
+			remaining = append(remaining, reviewerID)
+		}
+	}
+	return c.setReviewerIDs(ctx, ref, remaining)
+}
+
+func (c *GitLabClient) mergeRequestURL(ref ForgeRef) string {
+	return fmt.Sprintf("%s/projects/%s/merge_requests/%d", c.BaseURL, url.PathEscape(ref.Repository), ref.Number)
+}
+
+func (c *GitLabClient) reviewerIDs(ctx context.Context, ref ForgeRef) ([]int, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.mergeRequestURL(ref), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var mr struct {
+		Reviewers []struct {
+			ID int `json:"id"`
+		} `json:"reviewers"`
+	}
+	if err := doForgeRequest(req, &mr); err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	for _, reviewer := range mr.Reviewers {
+		ids = append(ids, reviewer.ID)
+	}
+	return ids, nil
+}
+
+func (c *GitLabClient) setReviewerIDs(ctx context.Context, ref ForgeRef, ids []int) error {
+	body, err := json.Marshal(map[string][]int{"reviewer_ids": ids})
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, c.mergeRequestURL(ref), body)
+	if err != nil {
+		return err
+	}
+	return doForgeRequest(req, nil)
+}
+
+func (c *GitLabClient) userID(ctx context.Context, login string) (int, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.BaseURL+"/users?username="+url.QueryEscape(login), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var users []struct {
+		ID int `json:"id"`
+	}
+	if err := doForgeRequest(req, &users); err != nil {
+		return 0, err
+	}
+	if len(users) == 0 {
+		return 0, &ForgeAPIError{StatusCode: http.StatusNotFound, Body: "user " + login + " not found"}
+	}
+	return users[0].ID, nil
+}
+
+func (c *GitLabClient) newRequest(ctx context.Context, method, endpoint string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// doForgeRequest sends req and decodes a JSON response into out when it is not nil
+func doForgeRequest(req *http.Request, out interface{}) error {
+	resp, err := forgeHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &ForgeAPIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// forgeChange is a reviewer change to mirror onto a forge pull request
+type forgeChange struct {
+	action string
+	userID string
+}
+
+// forgeChanges lists the forge reviewer changes implied by an assignment event
+func forgeChanges(eventType string, payload EventPayload) []forgeChange {
+	switch eventType {
+	case EventReviewerAssigned:
+		return []forgeChange{{forgeRequestReviewer, payload.UserID}}
+	case EventReviewerUnassigned:
+		return []forgeChange{{forgeRemoveReviewer, payload.UserID}}
+	case EventReviewerReassigned:
+		return []forgeChange{{forgeRemoveReviewer, payload.OldUserID}, {forgeRequestReviewer, payload.NewUserID}}
+	}
+	return nil
+}
+
+// enqueueForgeSync queues forge reviewer changes for an assignment event. Only PRs
+// that came from a forge and reviewers with a linked login produce outbox entries.
+func enqueueForgeSync(q dbExecutor, eventType string, payload EventPayload) error {
+	for _, c := range forgeChanges(eventType, payload) {
+		_, err := q.Exec(`
+			INSERT INTO forge_outbox (forge, repository, number, action, login)
+			SELECT fp.forge, fp.repository, fp.number, $3, fa.login
+			FROM forge_pull_requests fp
+			JOIN forge_accounts fa ON fa.forge = fp.forge AND fa.user_id = $2
+			WHERE fp.pull_request_id = $1
+		`, payload.PullRequestID, c.userID, c.action)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueForgeSyncBatch is enqueueForgeSync for many events in a single statement,
+// keeping the order of the events
+func enqueueForgeSyncBatch(q dbExecutor, events []pendingEvent) error {
+	var prIDs, userIDs, actions []string
+	for _, e := range events {
+		for _, c := range forgeChanges(e.Type, e.Payload) {
+			prIDs = append(prIDs, e.Payload.PullRequestID)
+			userIDs = append(userIDs, c.userID)
+			actions = append(actions, c.action)
+		}
+	}
+	if len(prIDs) == 0 {
+		return nil
+	}
+
+	_, err := q.Exec(`
+		INSERT INTO forge_outbox (forge, repository, number, action, login)
+		SELECT fp.forge, fp.repository, fp.number, c.action, fa.login
+		FROM unnest($1::text[], $2::text[], $3::text[]) WITH ORDINALITY AS c(pull_request_id, user_id, action, n)
+		JOIN forge_pull_requests fp ON fp.pull_request_id = c.pull_request_id
+		JOIN forge_accounts fa ON fa.forge = fp.forge AND fa.user_id = c.user_id
+		ORDER BY c.n
+	`, pq.Array(prIDs), pq.Array(userIDs), pq.Array(actions))
+	return err
+}
+
+// runForgeOutbox drains the forge outbox until ctx is canceled
+func runForgeOutbox(ctx context.Context) {
+	interval := envDuration("FORGE_POLL_INTERVAL", 2*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := dispatchForgeOutbox(ctx); err != nil {
+				log.Printf("Error dispatching forge outbox: %v", err)
+			}
+		}
+	}
+}
+
+// dispatchForgeOutbox applies one batch of due outbox entries in creation order. A
+// forge outage only delays the entries; the API call that queued them has succeeded.
+// Entries of one PR are applied strictly in order: an entry waits while an earlier
+// entry of the same PR is still pending, so a retried request cannot undo a later
+// removal. An entry that has failed for good no longer holds the PR back.
+func dispatchForgeOutbox(ctx context.Context) error {
+	maxAttempts := envInt("FORGE_MAX_ATTEMPTS", 10)
+
+	rows, err := db.QueryContext(ctx, `
+		UPDATE forge_outbox
+		SET next_attempt_at = CURRENT_TIMESTAMP + INTERVAL '1 minute'
+		WHERE id IN (
+			SELECT id FROM forge_outbox o
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+				AND NOT EXISTS (
+					SELECT 1 FROM forge_outbox prev
+					WHERE prev.forge = o.forge AND prev.repository = o.repository AND prev.number = o.number
+						AND prev.id < o.id AND prev.status = 'pending'
+				)
+			ORDER BY id
+			LIMIT 20
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, forge, repository, number, action, login, attempts
+	`)
+	if err != nil {
+		return err
+	}
+
+	type outboxEntry struct {
+		ID       int64
+		Ref      ForgeRef
+		Action   string
+		Login    string
+		Attempts int
+	}
+	var batch []outboxEntry
+	func() {
+		defer func() {
+			if err := rows.Close(); err != nil {
+				log.Printf("Error closing rows: %v", err)
+			}
+		}()
+		for rows.Next() {
+			var e outboxEntry
+			if err := rows.Scan(&e.ID, &e.Ref.Forge, &e.Ref.Repository, &e.Ref.Number, &e.Action, &e.Login, &e.Attempts); err != nil {
+				log.Printf("Error scanning outbox entry: %v", err)
+				continue
+			}
+			batch = append(batch, e)
+		}
+	}()
+
+	// RETURNING does not preserve the subquery order
+	sort.Slice(batch, func(i, j int) bool { return batch[i].ID < batch[j].ID })
+
+	for _, e := range batch {
+		var syncErr error
+		client, ok := forgeClients[e.Ref.Forge]
+		switch {
+		case !ok:
+			syncErr = &ForgeAPIError{StatusCode: http.StatusNotImplemented, Body: "no client configured for " + e.Ref.Forge}
+		case e.Action == forgeRequestReviewer:
+			syncErr = client.RequestReviewers(ctx, e.Ref, []string{e.Login})
+		default:
+			syncErr = client.RemoveReviewer(ctx, e.Ref, e.Login)
+		}
+
+		attempts := e.Attempts + 1
+		if syncErr == nil {
+			_, err = db.ExecContext(ctx, `
+				UPDATE forge_outbox SET status = 'done', attempts = $1, last_error = NULL, completed_at = CURRENT_TIMESTAMP
+				WHERE id = $2
+			`, attempts, e.ID)
+		} else if apiErr, ok := syncErr.(*ForgeAPIError); (ok && apiErr.permanent()) || attempts >= maxAttempts {
+			log.Printf("Giving up on forge %s of %s for %s: %v", e.Action, e.Login, e.Ref.PullRequestID(), syncErr)
+			_, err = db.ExecContext(ctx, `
+				UPDATE forge_outbox SET status = 'failed', attempts = $1, last_error = $2
+				WHERE id = $3
+			`, attempts, syncErr.Error(), e.ID)
+		} else {
+			_, err = db.ExecContext(ctx, `
+				UPDATE forge_outbox
+				SET attempts = $1, last_error = $2, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+				WHERE id = $4
+			`, attempts, syncErr.Error(), retryBackoff(attempts).Seconds(), e.ID)
+		}
+		if err != nil {
+			log.Printf("Error updating outbox entry %d: %v", e.ID, err)
+		}
+	}
+
+	return nil
+}
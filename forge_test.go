@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeForgeClient records the calls it receives and fails with err when set
+type fakeForgeClient struct {
+	mu        sync.Mutex
+	requested []string
+	removed   []string
+	err       error
+}
+
+func (f *fakeForgeClient) RequestReviewers(_ context.Context, ref ForgeRef, logins []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	for _, login := range logins {
+		f.requested = append(f.requested, ref.PullRequestID()+"/"+login)
+	}
+	return nil
+}
+
+func (f *fakeForgeClient) RemoveReviewer(_ context.Context, ref ForgeRef, login string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.removed = append(f.removed, ref.PullRequestID()+"/"+login)
+	return nil
+}
+
+func TestGitHubClientRequestReviewers(t *testing.T) {
+	var gotMethod, gotPath, gotAuth string
+	var gotBody map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotAuth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client := &GitHubClient{BaseURL: server.URL, Token: "t0ken"}
+	ref := ForgeRef{Forge: forgeGitHub, Repository: "acme/api", Number: 42}
+	if err := client.RequestReviewers(context.Background(), ref, []string{"bob-gh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if gotMethod != http.MethodPost || gotPath != "/repos/acme/api/pulls/42/requested_reviewers" {
+		t.Errorf("Unexpected request %s %s", gotMethod, gotPath)
+	}
+	if gotAuth != "Bearer t0ken" {
+		t.Errorf("Unexpected Authorization header %q", gotAuth)
+	}
+	if len(gotBody["reviewers"]) != 1 || gotBody["reviewers"][0] != "bob-gh" {
+		t.Errorf("Unexpected body %v", gotBody)
+	}
+}
+
+func TestGitHubClientPermanentError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}))
+	defer server.Close()
+
+	client := &GitHubClient{BaseURL: server.URL, Token: "t0ken"}
+	err := client.RemoveReviewer(context.Background(), ForgeRef{Repository: "acme/api", Number: 1}, "bob-gh")
+	apiErr, ok := err.(*ForgeAPIError)
+	if !ok || !apiErr.permanent() {
+		t.Errorf("Expected permanent ForgeAPIError, got %v", err)
+	}
+}
+
+func TestGitLabClientRemoveReviewer(t *testing.T) {
+	var putBody map[string][]int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/users":
+			_, _ = w.Write([]byte(`[{"id": 12}]`))
+		case r.Method == http.MethodGet:
+			_, _ = w.Write([]byte(`{"reviewers": [{"id": 11}, {"id": 12}]}`))
+		case r.Method == http.MethodPut:
+			_ = json.NewDecoder(r.Body).Decode(&putBody)
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &GitLabClient{BaseURL: server.URL, Token: "t0ken"}
+	ref := ForgeRef{Forge: forgeGitLab, Repository: "acme/api", Number: 7}
+	if err := client.RemoveReviewer(context.Background(), ref, "bob-gl"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(putBody["reviewer_ids"]) != 1 || putBody["reviewer_ids"][0] != 11 {
+		t.Errorf("Expected reviewer_ids [11], got %v", putBody)
+	}
+}
+
+func TestForgeOutboxSync(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	fake := &fakeForgeClient{}
+	forgeClients[forgeGitHub] = fake
+	defer delete(forgeClients, forgeGitHub)
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO forge_accounts (forge, login, user_id) VALUES ('github', 'bob-gh', 'u2')")
+
+	ref := ForgeRef{Forge: forgeGitHub, Repository: "acme/api", Number: 42}
+	_, _, err := createPullRequest(PullRequestCreateRequest{
+		PullRequestID:   ref.PullRequestID(),
+		PullRequestName: "Add search endpoint",
+		AuthorID:        "u1",
+		Forge:           &ref,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dispatchForgeOutbox(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.requested) != 1 || fake.requested[0] != "github:acme/api:42/bob-gh" {
+		t.Errorf("Expected bob-gh to be requested, got %v", fake.requested)
+	}
+
+	var status string
+	_ = testDB.QueryRow("SELECT status FROM forge_outbox ORDER BY id LIMIT 1").Scan(&status)
+	if status != "done" {
+		t.Errorf("Expected outbox entry done, got %s", status)
+	}
+}
+
+func TestForgeOutageDoesNotFailCreate(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	fake := &fakeForgeClient{err: &ForgeAPIError{StatusCode: http.StatusBadGateway}}
+	forgeClients[forgeGitHub] = fake
+	defer delete(forgeClients, forgeGitHub)
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO forge_accounts (forge, login, user_id) VALUES ('github', 'bob-gh', 'u2')")
+
+	ref := ForgeRef{Forge: forgeGitHub, Repository: "acme/api", Number: 42}
+	if _, _, err := createPullRequest(PullRequestCreateRequest{PullRequestID: ref.PullRequestID(), AuthorID: "u1", Forge: &ref}); err != nil {
+		t.Fatalf("Create must not depend on the forge: %v", err)
+	}
+
+	_ = dispatchForgeOutbox(context.Background())
+
+	var status string
+	var attempts int
+	_ = testDB.QueryRow("SELECT status, attempts FROM forge_outbox ORDER BY id LIMIT 1").Scan(&status, &attempts)
+	if status != "pending" || attempts != 1 {
+		t.Errorf("Expected entry to stay pending for retry, got %s after %d attempts", status, attempts)
+	}
+}
+
+func TestForgeOutboxKeepsPullRequestOrder(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	fake := &fakeForgeClient{err: &ForgeAPIError{StatusCode: http.StatusBadGateway}}
+	forgeClients[forgeGitHub] = fake
+	defer delete(forgeClients, forgeGitHub)
+
+	_, _ = testDB.Exec("INSERT INTO forge_outbox (forge, repository, number, action, login) VALUES ('github', 'acme/api', 42, 'request', 'bob-gh')")
+	_, _ = testDB.Exec("INSERT INTO forge_outbox (forge, repository, number, action, login) VALUES ('github', 'acme/api', 42, 'remove', 'bob-gh')")
+
+	// The request fails transiently, so the removal must wait for its retry
+	_ = dispatchForgeOutbox(context.Background())
+	var attempts int
+	_ = testDB.QueryRow("SELECT attempts FROM forge_outbox WHERE action = 'remove'").Scan(&attempts)
+	if attempts != 0 || len(fake.removed) != 0 {
+		t.Errorf("Expected the removal to wait for the earlier request, got %d attempts", attempts)
+	}
+
+	fake.err = nil
+	_, _ = testDB.Exec("UPDATE forge_outbox SET next_attempt_at = CURRENT_TIMESTAMP")
+	_ = dispatchForgeOutbox(context.Background())
+	_ = dispatchForgeOutbox(context.Background())
+	if len(fake.requested) != 1 || len(fake.removed) != 1 {
+		t.Errorf("Expected the request and then the removal, got %v and %v", fake.requested, fake.removed)
+	}
+}
+
+func TestForgeOutboxSkipsPastFailedEntry(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	fake := &fakeForgeClient{err: &ForgeAPIError{StatusCode: http.StatusUnprocessableEntity}}
+	forgeClients[forgeGitHub] = fake
+	defer delete(forgeClients, forgeGitHub)
+
+	_, _ = testDB.Exec("INSERT INTO forge_outbox (forge, repository, number, action, login) VALUES ('github', 'acme/api', 42, 'request', 'bob-gh')")
+	_, _ = testDB.Exec("INSERT INTO forge_outbox (forge, repository, number, action, login) VALUES ('github', 'acme/api', 42, 'remove', 'carol-gh')")
+
+	// The request fails permanently and must not hold the removal back
+	_ = dispatchForgeOutbox(context.Background())
+	fake.err = nil
+	_ = dispatchForgeOutbox(context.Background())
+
+	if len(fake.removed) != 1 || fake.removed[0] != "github:acme/api:42/carol-gh" {
+		t.Errorf("Expected the removal after the failed request, got %v", fake.removed)
+	}
+}
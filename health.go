@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// shuttingDown is set once a termination signal arrives so /readyz can fail fast
+var shuttingDown atomic.Bool
+
+// startedAt is used to report process uptime from /livez
+var startedAt = time.Now()
+
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
+// CheckResult describes a single probe check
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ProbeResponse is returned by /livez and /readyz
+type ProbeResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// livezHandler reports whether the process is alive. It deliberately does not
+// touch the database so a database outage does not get the pod restarted.
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	start := time.Now()
+	writeProbe(w, map[string]CheckResult{
+		"process": {
+			Status:    checkOK,
+			LatencyMs: elapsedMs(start),
+		},
+	})
+}
+
+// readyzHandler reports whether the instance can serve traffic: the database is
+// reachable, the schema is up to date, the pool has spare connections and the
+// server is not shutting down.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	writeProbe(w, map[string]CheckResult{
+		"shutdown":        shutdownCheck(),
+		"database":        databaseCheck(ctx),
+		"migrations":      migrationsCheck(ctx),
+		"connection_pool": poolCheck(db.Stats()),
+	})
+}
+
+func shutdownCheck() CheckResult {
+	if shuttingDown.Load() {
+		return CheckResult{Status: checkFail, Error: "server is shutting down"}
+	}
+	return CheckResult{Status: checkOK}
+}
+
+func databaseCheck(ctx context.Context) CheckResult {
+	start := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		return CheckResult{Status: checkFail, LatencyMs: elapsedMs(start), Error: err.Error()}
+	}
+	return CheckResult{Status: checkOK, LatencyMs: elapsedMs(start)}
+}
+
+func migrationsCheck(ctx context.Context) CheckResult {
+	start := time.Now()
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return CheckResult{Status: checkFail, LatencyMs: elapsedMs(start), Error: err.Error()}
+	}
+	if version < len(migrations) {
+		return CheckResult{
+			Status:    checkFail,
+			LatencyMs: elapsedMs(start),
+			Error:     fmt.Sprintf("schema at version %d, expected %d", version, len(migrations)),
+		}
+	}
+	return CheckResult{Status: checkOK, LatencyMs: elapsedMs(start)}
+}
+
+// poolCheck fails when every connection allowed by SetMaxOpenConns is in use
+func poolCheck(stats sql.DBStats) CheckResult {
+	if stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+		return CheckResult{
+			Status: checkFail,
+			Error:  fmt.Sprintf("all %d connections in use", stats.InUse),
+		}
+	}
+	return CheckResult{Status: checkOK}
+}
+
+func writeProbe(w http.ResponseWriter, checks map[string]CheckResult) {
+	resp := ProbeResponse{Status: checkOK, Checks: checks}
+	statusCode := http.StatusOK
+	for _, check := range checks {
+		if check.Status != checkOK {
+			resp.Status = checkFail
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func elapsedMs(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLivez(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/livez", nil)
+	w := httptest.NewRecorder()
+
+	livezHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var response ProbeResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Checks["process"].Status != checkOK {
+		t.Errorf("Expected process check ok, got %+v", response.Checks)
+	}
+}
+
+func TestPoolCheck(t *testing.T) {
+	if got := poolCheck(sql.DBStats{MaxOpenConnections: 10, InUse: 3}); got.Status != checkOK {
+		t.Errorf("Expected ok for pool with spare connections, got %+v", got)
+	}
+	if got := poolCheck(sql.DBStats{MaxOpenConnections: 10, InUse: 10}); got.Status != checkFail {
+		t.Errorf("Expected fail for saturated pool, got %+v", got)
+	}
+	if got := poolCheck(sql.DBStats{InUse: 100}); got.Status != checkOK {
+		t.Errorf("Expected ok for unbounded pool, got %+v", got)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	w := httptest.NewRecorder()
+
+	readyzHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Readiness must flip once shutdown starts
+	shuttingDown.Store(true)
+	defer shuttingDown.Store(false)
+
+	w2 := httptest.NewRecorder()
+	readyzHandler(w2, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w2.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 during shutdown, got %d", w2.Code)
+	}
+
+	var response ProbeResponse
+	_ = json.Unmarshal(w2.Body.Bytes(), &response)
+	if response.Checks["shutdown"].Status != checkFail {
+		t.Errorf("Expected shutdown check to fail, got %+v", response.Checks["shutdown"])
+	}
+}
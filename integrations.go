@@ -0,0 +1,452 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Supported forges
+const (
+	forgeGitHub = "github"
+	forgeGitLab = "gitlab"
+)
+
+// Normalized pull request lifecycle actions understood by applyForgeEvent
+const (
+	forgeActionOpened   = "opened"
+	forgeActionReopened = "reopened"
+	forgeActionClosed   = "closed"
+	forgeActionMerged   = "merged"
+)
+
+// maxForgePayload bounds the size of an inbound webhook body
+const maxForgePayload = 5 << 20
+
+// ForgeRef identifies a pull request on GitHub or a merge request on GitLab
+type ForgeRef struct {
+	Forge      string `json:"forge"`
+	Repository string `json:"repository"`
+	Number     int    `json:"number"`
+}
+
+// PullRequestID is the id under which a forge pull request is stored, e.g. "github:acme/api:42"
+func (ref ForgeRef) PullRequestID() string {
+	return fmt.Sprintf("%s:%s:%d", ref.Forge, ref.Repository, ref.Number)
+}
+
+// forgeEvent is a pull request webhook reduced to what the service needs. The author
+// is identified by AuthorLogin on GitHub and by AuthorForgeUserID on GitLab.
+type forgeEvent struct {
+	Ref               ForgeRef
+	Action            string
+	Title             string
+	AuthorLogin       string
+	AuthorForgeUserID int64
+}
+
+// ForgeAccount links a forge login, and optionally the forge's numeric user id, to a
+// user of the service
+type ForgeAccount struct {
+	Forge       string `json:"forge"`
+	Login       string `json:"login"`
+	UserID      string `json:"user_id"`
+	ForgeUserID *int64 `json:"forge_user_id,omitempty"`
+}
+
+// IntegrationResult describes what an inbound webhook did
+type IntegrationResult struct {
+	Result     string            `json:"result"`
+	Reason     string            `json:"reason,omitempty"`
+	PR         *PullRequest      `json:"pr,omitempty"`
+	Assignment *AssignmentReport `json:"assignment,omitempty"`
+}
+
+// githubWebhookHandler receives GitHub "pull_request" webhooks signed with GITHUB_WEBHOOK_SECRET
+func githubWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxForgePayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !verifyGitHubSignature(os.Getenv("GITHUB_WEBHOOK_SECRET"), body, r.Header.Get("X-Hub-Signature-256")) {
+		sendError(w, http.StatusUnauthorized, "INVALID_SIGNATURE", "signature verification failed")
+		return
+	}
+
+	switch r.Header.Get("X-GitHub-Event") {
+	case "ping":
+		writeIntegrationResult(w, IntegrationResult{Result: "pong"})
+		return
+	case "pull_request":
+	default:
+		writeIntegrationResult(w, IntegrationResult{Result: "ignored", Reason: "unsupported event"})
+		return
+	}
+
+	event, err := parseGitHubPullRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	handleForgeEvent(w, event)
+}
+
+// gitlabWebhookHandler receives GitLab "Merge Request Hook" webhooks carrying GITLAB_WEBHOOK_TOKEN
+func gitlabWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxForgePayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !verifyGitLabToken(os.Getenv("GITLAB_WEBHOOK_TOKEN"), r.Header.Get("X-Gitlab-Token")) {
+		sendError(w, http.StatusUnauthorized, "INVALID_SIGNATURE", "token verification failed")
+		return
+	}
+
+	if r.Header.Get("X-Gitlab-Event") != "Merge Request Hook" {
+		writeIntegrationResult(w, IntegrationResult{Result: "ignored", Reason: "unsupported event"})
+		return
+	}
+
+	event, err := parseGitLabMergeRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	handleForgeEvent(w, event)
+}
+
+func handleForgeEvent(w http.ResponseWriter, event forgeEvent) {
+	result, err := applyForgeEvent(event)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeIntegrationResult(w, result)
+}
+
+// applyForgeEvent maps a forge lifecycle action onto the create, merge, close and
+// reopen logic. Reopening a tracked PR restores it to OPEN instead of creating it.
+func applyForgeEvent(event forgeEvent) (IntegrationResult, error) {
+	prID := event.Ref.PullRequestID()
+
+	switch event.Action {
+	case forgeActionOpened, forgeActionReopened:
+		authorID, err := resolveForgeAuthor(event)
+		if err != nil {
+			return IntegrationResult{}, err
+		}
+
+		ref := event.Ref
+		pr, report, err := createPullRequest(PullRequestCreateRequest{
+			PullRequestID:   prID,
+			PullRequestName: event.Title,
+			AuthorID:        authorID,
+			Forge:           &ref,
+		})
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Code == "PR_EXISTS" && event.Action == forgeActionReopened {
+			reopened, err := reopenPullRequest(prID)
+			if err != nil {
+				return IntegrationResult{}, err
+			}
+			return IntegrationResult{Result: "reopened", PR: &reopened}, nil
+		}
+		if errors.As(err, &apiErr) && apiErr.Code == "PR_EXISTS" {
+			existing := getPullRequest(prID)
+			return IntegrationResult{Result: "ignored", Reason: "pull request already tracked", PR: &existing}, nil
+		}
+		if err != nil {
+			return IntegrationResult{}, err
+		}
+		return IntegrationResult{Result: "created", PR: &pr, Assignment: &report}, nil
+
+	case forgeActionMerged:
+		pr, err := mergePullRequest(prID)
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Code == "NOT_FOUND" {
+			return IntegrationResult{Result: "ignored", Reason: "pull request is not tracked"}, nil
+		}
+		if err != nil {
+			return IntegrationResult{}, err
+		}
+		return IntegrationResult{Result: "merged", PR: &pr}, nil
+
+	case forgeActionClosed:
+		pr, err := closePullRequest(prID)
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Code == "NOT_FOUND" {
+			return IntegrationResult{Result: "ignored", Reason: "pull request is not tracked"}, nil
+		}
+		if err != nil {
+			return IntegrationResult{}, err
+		}
+		return IntegrationResult{Result: "closed", PR: &pr}, nil
+
+	default:
+		return IntegrationResult{Result: "ignored", Reason: "action " + event.Action + " is not tracked"}, nil
+	}
+}
+
+// resolveForgeAuthor returns the user_id of the event's author, looked up by forge user
+// id when the forge sends one and by login otherwise
+func resolveForgeAuthor(event forgeEvent) (string, error) {
+	if event.AuthorForgeUserID == 0 {
+		return resolveForgeLogin(event.Ref.Forge, event.AuthorLogin)
+	}
+	var userID string
+	err := db.QueryRow("SELECT user_id FROM forge_accounts WHERE forge = $1 AND forge_user_id = $2", event.Ref.Forge, event.AuthorForgeUserID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", &apiError{http.StatusUnprocessableEntity, "UNKNOWN_FORGE_USER", fmt.Sprintf("%s user %d is not linked to a user", event.Ref.Forge, event.AuthorForgeUserID), ""}
+	}
+	return userID, err
+}
+
+// resolveForgeLogin returns the user_id linked to a forge login
+func resolveForgeLogin(forge, login string) (string, error) {
+	var userID string
+	err := db.QueryRow("SELECT user_id FROM forge_accounts WHERE forge = $1 AND login = $2", forge, login).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", &apiError{http.StatusUnprocessableEntity, "UNKNOWN_FORGE_USER", forge + " login " + login + " is not linked to a user", ""}
+	}
+	return userID, err
+}
+
+// parseGitHubPullRequest extracts the lifecycle action from a "pull_request" webhook payload
+func parseGitHubPullRequest(body []byte) (forgeEvent, error) {
+	var payload struct {
+		Action      string `json:"action"`
+		PullRequest struct {
+			Number int    `json:"number"`
+			Title  string `json:"title"`
+			Merged bool   `json:"merged"`
+			User   struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"pull_request"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return forgeEvent{}, err
+	}
+	if payload.Repository.FullName == "" || payload.PullRequest.Number == 0 {
+		return forgeEvent{}, fmt.Errorf("payload is missing repository or pull request number")
+	}
+
+	action := payload.Action
+	if action == forgeActionClosed && payload.PullRequest.Merged {
+		action = forgeActionMerged
+	}
+
+	return forgeEvent{
+		Ref: ForgeRef{
+			Forge:      forgeGitHub,
+			Repository: payload.Repository.FullName,
+			Number:     payload.PullRequest.Number,
+		},
+		Action:      action,
+		Title:       payload.PullRequest.Title,
+		AuthorLogin: payload.PullRequest.User.Login,
+	}, nil
+}
+
+// gitlabActions maps object_attributes.action onto the normalized actions
+var gitlabActions = map[string]string{
+	"open":   forgeActionOpened,
+	"reopen": forgeActionReopened,
+	"close":  forgeActionClosed,
+	"merge":  forgeActionMerged,
+}
+
+// parseGitLabMergeRequest extracts the lifecycle action from a "Merge Request Hook" payload.
+// GitLab sends only the author's numeric id; "user" is whoever triggered the hook.
+func parseGitLabMergeRequest(body []byte) (forgeEvent, error) {
+	var payload struct {
+		ObjectKind string `json:"object_kind"`
+		Project    struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+		ObjectAttributes struct {
+			IID      int    `json:"iid"`
+			Title    string `json:"title"`
+			Action   string `json:"action"`
+			AuthorID int64  `json:"author_id"`
+		} `json:"object_attributes"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return forgeEvent{}, err
+	}
+	if payload.ObjectKind != "merge_request" {
+		return forgeEvent{}, fmt.Errorf("unexpected object_kind %q", payload.ObjectKind)
+	}
+	if payload.Project.PathWithNamespace == "" || payload.ObjectAttributes.IID == 0 {
+		return forgeEvent{}, fmt.Errorf("payload is missing project or merge request iid")
+	}
+
+	action, ok := gitlabActions[payload.ObjectAttributes.Action]
+	if !ok {
+		action = payload.ObjectAttributes.Action
+	}
+
+	return forgeEvent{
+		Ref: ForgeRef{
+			Forge:      forgeGitLab,
+			Repository: payload.Project.PathWithNamespace,
+			Number:     payload.ObjectAttributes.IID,
+		},
+		Action:            action,
+		Title:             payload.ObjectAttributes.Title,
+		AuthorForgeUserID: payload.ObjectAttributes.AuthorID,
+	}, nil
+}
+
+// verifyGitHubSignature checks the X-Hub-Signature-256 header. An unset secret rejects everything.
+func verifyGitHubSignature(secret string, body []byte, header string) bool {
+	if secret == "" {
+		return false
+	}
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(signPayload(secret, body)))
+}
+
+// verifyGitLabToken checks the X-Gitlab-Token header. An unset token rejects everything.
+func verifyGitLabToken(token, header string) bool {
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(header)) == 1
+}
+
+func writeIntegrationResult(w http.ResponseWriter, result IntegrationResult) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// forgeAccountLinkHandler links (or relinks) a forge login to a user
+func forgeAccountLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var account ForgeAccount
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if account.Forge != forgeGitHub && account.Forge != forgeGitLab {
+		http.Error(w, "forge must be github or gitlab", http.StatusBadRequest)
+		return
+	}
+	if account.Login == "" {
+		http.Error(w, "login is required", http.StatusBadRequest)
+		return
+	}
+	if account.ForgeUserID != nil && *account.ForgeUserID <= 0 {
+		http.Error(w, "forge_user_id must be positive", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1)", account.UserID).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "user not found")
+		return
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO forge_accounts (forge, login, user_id, forge_user_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (forge, login) DO UPDATE SET user_id = $3, forge_user_id = $4
+	`, account.Forge, account.Login, account.UserID, account.ForgeUserID)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		sendError(w, http.StatusConflict, "FORGE_USER_LINKED", "forge_user_id is already linked to another login")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"account": account}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// forgeAccountListHandler lists forge logins, optionally only those of one user
+func forgeAccountListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	rows, err := db.Query(`
+		SELECT forge, login, user_id, forge_user_id FROM forge_accounts
+		WHERE $1 = '' OR user_id = $1
+		ORDER BY forge, login
+	`, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	accounts := []ForgeAccount{}
+	for rows.Next() {
+		var account ForgeAccount
+		if err := rows.Scan(&account.Forge, &account.Login, &account.UserID, &account.ForgeUserID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		accounts = append(accounts, account)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"accounts": accounts}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
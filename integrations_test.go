@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %v", name, err)
+	}
+	return body
+}
+
+func TestParseGitHubPullRequest(t *testing.T) {
+	cases := []struct {
+		fixture string
+		action  string
+		number  int
+	}{
+		{"github/pull_request_opened.json", forgeActionOpened, 42},
+		{"github/pull_request_closed_merged.json", forgeActionMerged, 42},
+		{"github/pull_request_closed.json", forgeActionClosed, 43},
+		{"github/pull_request_reopened.json", forgeActionReopened, 43},
+	}
+
+	for _, tc := range cases {
+		event, err := parseGitHubPullRequest(loadFixture(t, tc.fixture))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.fixture, err)
+		}
+		if event.Action != tc.action {
+			t.Errorf("%s: expected action %s, got %s", tc.fixture, tc.action, event.Action)
+		}
+		if event.Ref.Number != tc.number || event.Ref.Repository != "acme/api" {
+			t.Errorf("%s: unexpected ref %+v", tc.fixture, event.Ref)
+		}
+		if event.AuthorLogin != "alice-gh" {
+			t.Errorf("%s: expected author alice-gh, got %s", tc.fixture, event.AuthorLogin)
+		}
+	}
+}
+
+func TestParseGitLabMergeRequest(t *testing.T) {
+	opened, err := parseGitLabMergeRequest(loadFixture(t, "gitlab/merge_request_open.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.Action != forgeActionOpened || opened.AuthorForgeUserID != 2001 {
+		t.Errorf("Unexpected open event %+v", opened)
+	}
+	if opened.Ref.PullRequestID() != "gitlab:acme/api:7" {
+		t.Errorf("Unexpected pull request id %s", opened.Ref.PullRequestID())
+	}
+
+	merged, err := parseGitLabMergeRequest(loadFixture(t, "gitlab/merge_request_merge.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Action != forgeActionMerged {
+		t.Errorf("Expected merged action, got %s", merged.Action)
+	}
+}
+
+func TestGitHubWebhookRejectsBadSignature(t *testing.T) {
+	t.Setenv("GITHUB_WEBHOOK_SECRET", "s3cret")
+
+	req := httptest.NewRequest(http.MethodPost, "/integrations/github", bytes.NewReader(loadFixture(t, "github/pull_request_opened.json")))
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	req.Header.Set("X-Hub-Signature-256", "sha256=deadbeef")
+	w := httptest.NewRecorder()
+
+	githubWebhookHandler(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+}
+
+func TestGitLabWebhookRejectsBadToken(t *testing.T) {
+	t.Setenv("GITLAB_WEBHOOK_TOKEN", "s3cret")
+
+	req := httptest.NewRequest(http.MethodPost, "/integrations/gitlab", bytes.NewReader(loadFixture(t, "gitlab/merge_request_open.json")))
+	req.Header.Set("X-Gitlab-Event", "Merge Request Hook")
+	req.Header.Set("X-Gitlab-Token", "wrong")
+	w := httptest.NewRecorder()
+
+	gitlabWebhookHandler(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+}
+
+func postGitHubFixture(t *testing.T, fixture string) *httptest.ResponseRecorder {
+	t.Helper()
+	body := loadFixture(t, fixture)
+	req := httptest.NewRequest(http.MethodPost, "/integrations/github", bytes.NewReader(body))
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+signPayload("s3cret", body))
+	w := httptest.NewRecorder()
+	githubWebhookHandler(w, req)
+	return w
+}
+
+func TestGitHubPullRequestLifecycle(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+	t.Setenv("GITHUB_WEBHOOK_SECRET", "s3cret")
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO forge_accounts (forge, login, user_id) VALUES ('github', 'alice-gh', 'u1')")
+
+	w := postGitHubFixture(t, "github/pull_request_opened.json")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var created IntegrationResult
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Result != "created" || created.PR == nil || created.PR.AuthorID != "u1" {
+		t.Fatalf("Expected PR created for u1, got %s", w.Body.String())
+	}
+
+	w = postGitHubFixture(t, "github/pull_request_closed_merged.json")
+	var merged IntegrationResult
+	_ = json.Unmarshal(w.Body.Bytes(), &merged)
+	if merged.Result != "merged" || merged.PR == nil || merged.PR.Status != "MERGED" {
+		t.Errorf("Expected PR merged, got %s", w.Body.String())
+	}
+
+	// Closing a PR the service does not track is ignored
+	w = postGitHubFixture(t, "github/pull_request_closed.json")
+	var closed IntegrationResult
+	_ = json.Unmarshal(w.Body.Bytes(), &closed)
+	if closed.Result != "ignored" {
+		t.Errorf("Expected closed event to be ignored, got %s", w.Body.String())
+	}
+}
+
+func TestGitHubUnknownAuthor(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+	t.Setenv("GITHUB_WEBHOOK_SECRET", "s3cret")
+
+	w := postGitHubFixture(t, "github/pull_request_opened.json")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGitLabMergeRequestUsesAuthorID(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+	t.Setenv("GITLAB_WEBHOOK_TOKEN", "s3cret")
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	// The login of the hook's actor must not matter, only the linked author_id
+	_, _ = testDB.Exec("INSERT INTO forge_accounts (forge, login, user_id, forge_user_id) VALUES ('gitlab', 'alice-gl', 'u1', 2001)")
+	_, _ = testDB.Exec("INSERT INTO forge_accounts (forge, login, user_id) VALUES ('gitlab', 'bob-gl', 'u2')")
+
+	req := httptest.NewRequest(http.MethodPost, "/integrations/gitlab", bytes.NewReader(loadFixture(t, "gitlab/merge_request_open.json")))
+	req.Header.Set("X-Gitlab-Event", "Merge Request Hook")
+	req.Header.Set("X-Gitlab-Token", "s3cret")
+	w := httptest.NewRecorder()
+	gitlabWebhookHandler(w, req)
+
+	var created IntegrationResult
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Result != "created" || created.PR == nil || created.PR.AuthorID != "u1" {
+		t.Errorf("Expected PR created for u1, got %s", w.Body.String())
+	}
+}
+
+func TestGitHubCloseAndReopen(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+	t.Setenv("GITHUB_WEBHOOK_SECRET", "s3cret")
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, default_max_open_reviews) VALUES ('backend', 1)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO forge_accounts (forge, login, user_id) VALUES ('github', 'alice-gh', 'u1')")
+
+	// A reopen of an unknown PR creates it like an open
+	w := postGitHubFixture(t, "github/pull_request_reopened.json")
+	var created IntegrationResult
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Result != "created" {
+		t.Fatalf("Expected PR created, got %s", w.Body.String())
+	}
+
+	w = postGitHubFixture(t, "github/pull_request_closed.json")
+	var closed IntegrationResult
+	_ = json.Unmarshal(w.Body.Bytes(), &closed)
+	if closed.Result != "closed" || closed.PR == nil || closed.PR.Status != "CLOSED" {
+		t.Fatalf("Expected PR closed, got %s", w.Body.String())
+	}
+	// The review on the closed PR no longer counts against u2's cap
+	if _, atCapacity, _ := splitByCapacity(db, []string{"u2"}); len(atCapacity) != 0 {
+		t.Error("Expected u2 to be below capacity while the PR is closed")
+	}
+
+	w = postGitHubFixture(t, "github/pull_request_reopened.json")
+	var reopened IntegrationResult
+	_ = json.Unmarshal(w.Body.Bytes(), &reopened)
+	if reopened.Result != "reopened" || reopened.PR == nil || reopened.PR.Status != "OPEN" || len(reopened.PR.AssignedReviewers) != 1 {
+		t.Errorf("Expected PR reopened with its reviewer, got %s", w.Body.String())
+	}
+}
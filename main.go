@@ -3,30 +3,38 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"crypto/rand"
 	"log"
 	"math/big"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type ErrorResponse struct {
 	Error struct {
 		Code    string `json:"code"`
 		Message string `json:"message"`
+		Reason  string `json:"reason,omitempty"`
 	} `json:"error"`
 }
 
 type TeamMember struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	IsActive bool   `json:"is_active"`
+	UserID   string   `json:"user_id"`
+	Username string   `json:"username"`
+	IsActive bool     `json:"is_active"`
+	Tags     []string `json:"tags"`
 }
 
 type Team struct {
@@ -42,13 +50,15 @@ type User struct {
 }
 
 type PullRequest struct {
-	PullRequestID     string    `json:"pull_request_id"`
-	PullRequestName   string    `json:"pull_request_name"`
-	AuthorID          string    `json:"author_id"`
-	Status            string    `json:"status"`
-	AssignedReviewers []string  `json:"assigned_reviewers"`
-	CreatedAt         *string   `json:"createdAt,omitempty"`
-	MergedAt          *string   `json:"mergedAt,omitempty"`
+	PullRequestID     string         `json:"pull_request_id"`
+	PullRequestName   string         `json:"pull_request_name"`
+	AuthorID          string         `json:"author_id"`
+	Status            string         `json:"status"`
+	AssignedReviewers []string       `json:"assigned_reviewers"`
+	ReviewerSlots     []ReviewerSlot `json:"reviewer_slots"`
+	RequiredTags      []string       `json:"required_tags"`
+	CreatedAt         *string        `json:"createdAt,omitempty"`
+	MergedAt          *string        `json:"mergedAt,omitempty"`
 }
 
 type PullRequestShort struct {
@@ -60,6 +70,237 @@ type PullRequestShort struct {
 
 var db *sql.DB
 
+// migrations lists schema changes in the order they are applied. Each entry runs
+// once and is recorded in schema_migrations, so new changes must be appended.
+var migrations = []string{
+	`
+	CREATE TABLE IF NOT EXISTS teams (
+		team_name VARCHAR(255) PRIMARY KEY
+	);
+
+	CREATE TABLE IF NOT EXISTS users (
+		user_id VARCHAR(255) PRIMARY KEY,
+		username VARCHAR(255) NOT NULL,
+		team_name VARCHAR(255) NOT NULL REFERENCES teams(team_name),
+		is_active BOOLEAN NOT NULL DEFAULT true
+	);
+
+	CREATE TABLE IF NOT EXISTS pull_requests (
+		pull_request_id VARCHAR(255) PRIMARY KEY,
+		pull_request_name VARCHAR(255) NOT NULL,
+		author_id VARCHAR(255) NOT NULL REFERENCES users(user_id),
+		status VARCHAR(10) NOT NULL CHECK (status IN ('OPEN', 'MERGED')),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		merged_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS pr_reviewers (
+		pull_request_id VARCHAR(255) NOT NULL REFERENCES pull_requests(pull_request_id),
+		user_id VARCHAR(255) NOT NULL REFERENCES users(user_id),
+		PRIMARY KEY (pull_request_id, user_id)
+	);
+	`,
+	`
+	CREATE TABLE events (
+		id BIGSERIAL PRIMARY KEY,
+		event_type VARCHAR(64) NOT NULL,
+		pull_request_id VARCHAR(255),
+		recipients TEXT[] NOT NULL DEFAULT '{}',
+		payload JSONB NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE webhook_subscriptions (
+		id BIGSERIAL PRIMARY KEY,
+		url TEXT NOT NULL,
+		event_types TEXT[] NOT NULL,
+		secret TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		subscription_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+		event_id BIGINT NOT NULL REFERENCES events(id),
+		status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_status_code INTEGER,
+		last_error TEXT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		delivered_at TIMESTAMP
+	);
+
+	CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+	`,
+	`
+	CREATE TABLE forge_accounts (
+		forge VARCHAR(16) NOT NULL CHECK (forge IN ('github', 'gitlab')),
+		login VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL REFERENCES users(user_id),
+		PRIMARY KEY (forge, login)
+	);
+
+	CREATE TABLE forge_pull_requests (
+		pull_request_id VARCHAR(255) PRIMARY KEY REFERENCES pull_requests(pull_request_id),
+		forge VARCHAR(16) NOT NULL,
+		repository VARCHAR(255) NOT NULL,
+		number INTEGER NOT NULL,
+		UNIQUE (forge, repository, number)
+	);
+	`,
+	`
+	CREATE TABLE forge_outbox (
+		id BIGSERIAL PRIMARY KEY,
+		forge VARCHAR(16) NOT NULL,
+		repository VARCHAR(255) NOT NULL,
+		number INTEGER NOT NULL,
+		action VARCHAR(10) NOT NULL CHECK (action IN ('request', 'remove')),
+		login VARCHAR(255) NOT NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'done', 'failed')),
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_error TEXT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP
+	);
+
+	CREATE INDEX forge_outbox_due_idx ON forge_outbox (next_attempt_at) WHERE status = 'pending';
+	`,
+	`
+	CREATE INDEX events_recipients_idx ON events USING GIN (recipients);
+	`,
+	`
+	CREATE TABLE user_absences (
+		id BIGSERIAL PRIMARY KEY,
+		user_id VARCHAR(255) NOT NULL REFERENCES users(user_id),
+		starts_at TIMESTAMP NOT NULL,
+		ends_at TIMESTAMP NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		auto_reassign BOOLEAN NOT NULL DEFAULT false,
+		reassigned_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		CHECK (ends_at > starts_at)
+	);
+
+	CREATE INDEX user_absences_user_idx ON user_absences (user_id, ends_at);
+	`,
+	`
+	ALTER TABLE users
+		ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+		ADD COLUMN work_start TIME,
+		ADD COLUMN work_end TIME;
+
+	ALTER TABLE pr_reviewers ADD COLUMN assignment_reason TEXT;
+	`,
+	`
+	ALTER TABLE users ADD COLUMN max_open_reviews INTEGER CHECK (max_open_reviews >= 0);
+	ALTER TABLE teams ADD COLUMN default_max_open_reviews INTEGER CHECK (default_max_open_reviews >= 0);
+	`,
+	`
+	CREATE TABLE team_groups (
+		team_name VARCHAR(255) NOT NULL REFERENCES teams(team_name),
+		group_name VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL REFERENCES users(user_id),
+		PRIMARY KEY (team_name, group_name, user_id)
+	);
+
+	CREATE TABLE code_owner_rules (
+		team_name VARCHAR(255) NOT NULL REFERENCES teams(team_name),
+		position INTEGER NOT NULL,
+		pattern TEXT NOT NULL,
+		owners TEXT[] NOT NULL DEFAULT '{}',
+		PRIMARY KEY (team_name, position)
+	);
+	`,
+	`
+	CREATE TABLE team_fallbacks (
+		team_name VARCHAR(255) NOT NULL REFERENCES teams(team_name),
+		position INTEGER NOT NULL,
+		fallback_team VARCHAR(255) NOT NULL REFERENCES teams(team_name),
+		PRIMARY KEY (team_name, position),
+		UNIQUE (team_name, fallback_team),
+		CHECK (fallback_team <> team_name)
+	);
+
+	ALTER TABLE pr_reviewers ADD COLUMN fallback_team VARCHAR(255);
+	`,
+	`
+	ALTER TABLE users ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+	ALTER TABLE pull_requests ADD COLUMN required_tags TEXT[] NOT NULL DEFAULT '{}';
+	`,
+	`
+	ALTER TABLE users ADD COLUMN seniority VARCHAR(16) CHECK (seniority IN ('junior', 'middle', 'senior', 'lead'));
+	ALTER TABLE teams ADD COLUMN min_reviewer_seniority VARCHAR(16) CHECK (min_reviewer_seniority IN ('junior', 'middle', 'senior', 'lead'));
+	`,
+	`
+	CREATE TABLE review_constraints (
+		id BIGSERIAL PRIMARY KEY,
+		kind VARCHAR(32) NOT NULL CHECK (kind IN ('never_pair', 'avoid_repeat_pair')),
+		author_id VARCHAR(255) REFERENCES users(user_id),
+		reviewer_id VARCHAR(255) REFERENCES users(user_id),
+		bidirectional BOOLEAN NOT NULL DEFAULT false,
+		team_name VARCHAR(255) REFERENCES teams(team_name),
+		reason TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX review_constraints_author_idx ON review_constraints (author_id) WHERE kind = 'never_pair';
+	CREATE INDEX review_constraints_reviewer_idx ON review_constraints (reviewer_id) WHERE kind = 'never_pair';
+	`,
+	`
+	ALTER TABLE teams ADD COLUMN reassign_on_deactivate BOOLEAN NOT NULL DEFAULT false;
+	`,
+	`
+	ALTER TABLE teams ADD COLUMN reminder_after_hours INTEGER CHECK (reminder_after_hours > 0);
+	ALTER TABLE teams ADD COLUMN escalate_after_hours INTEGER CHECK (escalate_after_hours > 0);
+	ALTER TABLE teams ADD COLUMN lead_user_id VARCHAR(255) REFERENCES users(user_id);
+
+	ALTER TABLE pr_reviewers ADD COLUMN assigned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+	UPDATE pr_reviewers r SET assigned_at = pr.created_at
+	FROM pull_requests pr
+	WHERE pr.pull_request_id = r.pull_request_id;
+	ALTER TABLE pr_reviewers ADD COLUMN reminded_at TIMESTAMP;
+	ALTER TABLE pr_reviewers ADD COLUMN escalated_at TIMESTAMP;
+	`,
+	`
+	ALTER TABLE teams ADD COLUMN sla_first_review_hours INTEGER CHECK (sla_first_review_hours > 0);
+	ALTER TABLE teams ADD COLUMN sla_merge_hours INTEGER CHECK (sla_merge_hours > 0);
+
+	ALTER TABLE pr_reviewers ADD COLUMN first_response_at TIMESTAMP;
+	`,
+	`
+	CREATE INDEX forge_outbox_unresolved_idx ON forge_outbox (forge, repository, number, id) WHERE status IN ('pending', 'failed');
+	`,
+	`
+	CREATE TABLE pr_reviewer_history (
+		id BIGSERIAL PRIMARY KEY,
+		pull_request_id VARCHAR(255) NOT NULL REFERENCES pull_requests(pull_request_id),
+		user_id VARCHAR(255) NOT NULL REFERENCES users(user_id),
+		assigned_at TIMESTAMP NOT NULL,
+		first_response_at TIMESTAMP,
+		ended_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX pr_reviewer_history_assigned_idx ON pr_reviewer_history (assigned_at);
+	`,
+	`
+	ALTER TABLE forge_accounts ADD COLUMN forge_user_id BIGINT;
+	CREATE UNIQUE INDEX forge_accounts_forge_user_idx ON forge_accounts (forge, forge_user_id) WHERE forge_user_id IS NOT NULL;
+	`,
+	`
+	ALTER TABLE user_absences ADD COLUMN unreassigned_pr_ids TEXT[] NOT NULL DEFAULT '{}';
+	`,
+	`
+	ALTER TABLE pull_requests DROP CONSTRAINT pull_requests_status_check;
+	ALTER TABLE pull_requests ADD CONSTRAINT pull_requests_status_check CHECK (status IN ('OPEN', 'MERGED', 'CLOSED'));
+	ALTER TABLE pull_requests ADD COLUMN closed_at TIMESTAMP;
+	`,
+}
+
+// migrationLockID is the advisory lock key that serializes migrations between replicas
+const migrationLockID = 20250001
+
 func main() {
 	var err error
 	databaseURL := os.Getenv("DATABASE_URL")
@@ -89,22 +330,67 @@ func main() {
 		}
 	}()
 
+	// Bound the pool so readiness can report saturation
+	db.SetMaxOpenConns(envInt("DB_MAX_OPEN_CONNS", 25))
+
 	// Initialize database schema
 	initDB()
 
+	configureForgeClients()
+
 	// Setup routes
 	http.HandleFunc("/team/add", teamAddHandler)
 	http.HandleFunc("/team/get", teamGetHandler)
+	http.HandleFunc("/team/getSettings", teamGetSettingsHandler)
+	http.HandleFunc("/team/setSettings", teamSetSettingsHandler)
+	http.HandleFunc("/team/codeOwners/upload", codeOwnersUploadHandler)
+	http.HandleFunc("/team/codeOwners/list", codeOwnersListHandler)
+	http.HandleFunc("/team/groups/set", teamGroupSetHandler)
 	http.HandleFunc("/users/setIsActive", usersSetIsActiveHandler)
 	http.HandleFunc("/pullRequest/create", pullRequestCreateHandler)
+	http.HandleFunc("/pullRequest/previewAssignment", pullRequestPreviewAssignmentHandler)
 	http.HandleFunc("/pullRequest/merge", pullRequestMergeHandler)
 	http.HandleFunc("/pullRequest/reassign", pullRequestReassignHandler)
+	http.HandleFunc("/pullRequest/reviewers/add", pullRequestReviewersAddHandler)
+	http.HandleFunc("/pullRequest/reviewers/remove", pullRequestReviewersRemoveHandler)
+	http.HandleFunc("/pullRequest/respond", pullRequestRespondHandler)
 	http.HandleFunc("/users/getReview", usersGetReviewHandler)
+	http.HandleFunc("/users/reviewStream", usersReviewStreamHandler)
+	http.HandleFunc("/users/setWorkingHours", usersSetWorkingHoursHandler)
+	http.HandleFunc("/users/setMaxOpenReviews", usersSetMaxOpenReviewsHandler)
+	http.HandleFunc("/users/tags", usersTagsHandler)
+	http.HandleFunc("/users/setSeniority", usersSetSeniorityHandler)
+	http.HandleFunc("/users/absence/add", absenceAddHandler)
+	http.HandleFunc("/users/absence/list", absenceListHandler)
+	http.HandleFunc("/users/absence/update", absenceUpdateHandler)
+	http.HandleFunc("/users/absence/delete", absenceDeleteHandler)
 	
 	// Bonus endpoints
 	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/livez", livezHandler)
+	http.HandleFunc("/readyz", readyzHandler)
 	http.HandleFunc("/stats", statsHandler)
+	http.HandleFunc("/sla/report", slaReportHandler)
 	http.HandleFunc("/team/deactivate", teamDeactivateHandler)
+	http.HandleFunc("/team/activate", teamActivateHandler)
+	http.HandleFunc("/team/rebalance", teamRebalanceHandler)
+	http.HandleFunc("/constraints/add", constraintAddHandler)
+	http.HandleFunc("/constraints/list", constraintListHandler)
+	http.HandleFunc("/constraints/update", constraintUpdateHandler)
+	http.HandleFunc("/constraints/delete", constraintDeleteHandler)
+
+	// Outbound webhooks
+	http.HandleFunc("/webhooks/add", webhookAddHandler)
+	http.HandleFunc("/webhooks/list", webhookListHandler)
+	http.HandleFunc("/webhooks/delete", webhookDeleteHandler)
+	http.HandleFunc("/webhooks/deliveries", webhookDeliveriesHandler)
+	http.HandleFunc("/webhooks/redeliver", webhookRedeliverHandler)
+
+	// Inbound forge integrations
+	http.HandleFunc("/integrations/github", githubWebhookHandler)
+	http.HandleFunc("/integrations/gitlab", gitlabWebhookHandler)
+	http.HandleFunc("/integrations/accounts/link", forgeAccountLinkHandler)
+	http.HandleFunc("/integrations/accounts/list", forgeAccountListHandler)
 
 	log.Println("Server starting on :8080")
 	
@@ -115,42 +401,88 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
-	log.Fatal(server.ListenAndServe())
+	server.RegisterOnShutdown(broker.close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go runWebhookDispatcher(ctx)
+	go runForgeOutbox(ctx)
+	go runEventListener(ctx, databaseURL)
+	go runAbsenceScheduler(ctx)
+	go runStaleReviewScheduler(ctx)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	// Report not-ready first so load balancers stop routing before we stop accepting
+	shuttingDown.Store(true)
+	log.Println("Shutting down, draining connections")
+	time.Sleep(envDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
 }
 
 func initDB() {
-	schema := `
-	CREATE TABLE IF NOT EXISTS teams (
-		team_name VARCHAR(255) PRIMARY KEY
-	);
+	if err := migrate(db); err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+	log.Println("Database initialized successfully")
+}
 
-	CREATE TABLE IF NOT EXISTS users (
-		user_id VARCHAR(255) PRIMARY KEY,
-		username VARCHAR(255) NOT NULL,
-		team_name VARCHAR(255) NOT NULL REFERENCES teams(team_name),
-		is_active BOOLEAN NOT NULL DEFAULT true
-	);
+// migrate applies pending migrations in a single transaction
+func migrate(conn *sql.DB) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
 
-	CREATE TABLE IF NOT EXISTS pull_requests (
-		pull_request_id VARCHAR(255) PRIMARY KEY,
-		pull_request_name VARCHAR(255) NOT NULL,
-		author_id VARCHAR(255) NOT NULL REFERENCES users(user_id),
-		status VARCHAR(10) NOT NULL CHECK (status IN ('OPEN', 'MERGED')),
-		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		merged_at TIMESTAMP
-	);
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return err
+	}
 
-	CREATE TABLE IF NOT EXISTS pr_reviewers (
-		pull_request_id VARCHAR(255) NOT NULL REFERENCES pull_requests(pull_request_id),
-		user_id VARCHAR(255) NOT NULL REFERENCES users(user_id),
-		PRIMARY KEY (pull_request_id, user_id)
-	);
-	`
-	_, err := db.Exec(schema)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
 	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
+		return err
 	}
-	log.Println("Database initialized successfully")
+
+	var current int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", i+1); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func teamAddHandler(w http.ResponseWriter, r *http.Request) {
@@ -185,14 +517,19 @@ func teamAddHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Insert or update users
-	for _, member := range team.Members {
-		_, err = db.Exec(`
-			INSERT INTO users (user_id, username, team_name, is_active)
-			VALUES ($1, $2, $3, $4)
+	// Insert or update users; omitted tags keep an existing user's tags
+	for i, member := range team.Members {
+		var tags []string
+		if member.Tags != nil {
+			tags = normalizeTags(member.Tags)
+		}
+		err = db.QueryRow(`
+			INSERT INTO users (user_id, username, team_name, is_active, tags)
+			VALUES ($1, $2, $3, $4, COALESCE($5::text[], '{}'))
 			ON CONFLICT (user_id) DO UPDATE 
-			SET username = $2, team_name = $3, is_active = $4
-		`, member.UserID, member.Username, team.TeamName, member.IsActive)
+			SET username = $2, team_name = $3, is_active = $4, tags = COALESCE($5::text[], users.tags)
+			RETURNING tags
+		`, member.UserID, member.Username, team.TeamName, member.IsActive, pq.Array(tags)).Scan(pq.Array(&team.Members[i].Tags))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -232,7 +569,7 @@ func teamGetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get team members
-	rows, err := db.Query("SELECT user_id, username, is_active FROM users WHERE team_name = $1", teamName)
+	rows, err := db.Query("SELECT user_id, username, is_active, tags FROM users WHERE team_name = $1", teamName)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -246,7 +583,7 @@ func teamGetHandler(w http.ResponseWriter, r *http.Request) {
 	var members []TeamMember
 	for rows.Next() {
 		var member TeamMember
-		if err := rows.Scan(&member.UserID, &member.Username, &member.IsActive); err != nil {
+		if err := rows.Scan(&member.UserID, &member.Username, &member.IsActive, pq.Array(&member.Tags)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -273,6 +610,9 @@ func usersSetIsActiveHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		UserID   string `json:"user_id"`
 		IsActive bool   `json:"is_active"`
+		// ReassignReviews hands the user's OPEN reviews over on deactivation. When omitted
+		// the team's reassign_on_deactivate setting decides.
+		ReassignReviews *bool `json:"reassign_reviews"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -280,8 +620,21 @@ func usersSetIsActiveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The flag and the review handover commit together, so a deactivated user never
+	// keeps reviews that were meant to move
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
 	// Update user
-	result, err := db.Exec("UPDATE users SET is_active = $1 WHERE user_id = $2", req.IsActive, req.UserID)
+	result, err := tx.Exec("UPDATE users SET is_active = $1 WHERE user_id = $2", req.IsActive, req.UserID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -295,47 +648,119 @@ func usersSetIsActiveHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get updated user info
 	var user User
-	err = db.QueryRow("SELECT user_id, username, team_name, is_active FROM users WHERE user_id = $1", req.UserID).
-		Scan(&user.UserID, &user.Username, &user.TeamName, &user.IsActive)
+	var teamReassigns bool
+	err = tx.QueryRow(`
+		SELECT u.user_id, u.username, u.team_name, u.is_active, t.reassign_on_deactivate
+		FROM users u
+		JOIN teams t ON t.team_name = u.team_name
+		WHERE u.user_id = $1
+	`, req.UserID).Scan(&user.UserID, &user.Username, &user.TeamName, &user.IsActive, &teamReassigns)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	response := map[string]interface{}{"user": user}
+	reassign := teamReassigns
+	if req.ReassignReviews != nil {
+		reassign = *req.ReassignReviews
+	}
+	if !req.IsActive && reassign {
+		report, err := reassignOpenReviews(tx, req.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response["reassignment"] = report
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{"user": user}); err != nil {
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding response: %v", err)
 	}
 }
 
+// PullRequestCreateRequest is the body of /pullRequest/create
+type PullRequestCreateRequest struct {
+	PullRequestID   string `json:"pull_request_id"`
+	PullRequestName string `json:"pull_request_name"`
+	AuthorID        string `json:"author_id"`
+	// ChangedFiles are repository paths touched by the PR; their code owners are preferred as reviewers
+	ChangedFiles []string `json:"changed_files,omitempty"`
+	// RequiredTags rank candidates by how many of these skills they carry
+	RequiredTags []string `json:"required_tags,omitempty"`
+
+	// Forge links the PR to a GitHub/GitLab pull request when it comes from an integration
+	Forge *ForgeRef `json:"-"`
+}
+
+// assignmentAttempts is how many times create plans its reviewers when the chosen
+// ones fill up concurrently
+const assignmentAttempts = 3
+
+// reviewersPerPR is how many reviewer slots a new PR has
+const reviewersPerPR = 2
+
+// AssignmentReport tells the caller of /pullRequest/create how its reviewer slots were filled
+type AssignmentReport struct {
+	UnfilledSlots  int    `json:"unfilled_slots"`
+	UnfilledReason string `json:"unfilled_reason,omitempty"`
+	// MatchedRules are the code owner rules that own at least one of the changed files
+	MatchedRules []CodeOwnerRule `json:"matched_rules,omitempty"`
+	// UnsatisfiedRules are team rules no available candidate could satisfy
+	UnsatisfiedRules []string `json:"unsatisfied_rules,omitempty"`
+}
+
+// Reasons reported for unfilled reviewer slots
+const (
+	unfilledNotEnoughMembers = "not enough active team members"
+	unfilledAtCapacity       = "remaining candidates are at capacity"
+)
+
 func pullRequestCreateHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req struct {
-		PullRequestID   string `json:"pull_request_id"`
-		PullRequestName string `json:"pull_request_name"`
-		AuthorID        string `json:"author_id"`
-	}
-
+	var req PullRequestCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	pr, report, err := createPullRequest(req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"pr":         pr,
+		"assignment": report,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// createPullRequest stores a new OPEN pull request and assigns up to 2 reviewers from the author's team
+func createPullRequest(req PullRequestCreateRequest) (PullRequest, AssignmentReport, error) {
 	// Check if PR already exists
 	var exists bool
 	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pull_requests WHERE pull_request_id = $1)", req.PullRequestID).Scan(&exists)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return PullRequest{}, AssignmentReport{}, err
 	}
 
 	if exists {
-		sendError(w, http.StatusConflict, "PR_EXISTS", "PR id already exists")
-		return
+		return PullRequest{}, AssignmentReport{}, &apiError{http.StatusConflict, "PR_EXISTS", "PR id already exists", ""}
 	}
 
 	// Get author's team
@@ -343,55 +768,216 @@ func pullRequestCreateHandler(w http.ResponseWriter, r *http.Request) {
 	err = db.QueryRow("SELECT team_name FROM users WHERE user_id = $1", req.AuthorID).Scan(&authorTeam)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			sendError(w, http.StatusNotFound, "NOT_FOUND", "author not found")
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return PullRequest{}, AssignmentReport{}, &apiError{http.StatusNotFound, "NOT_FOUND", "author not found", ""}
 		}
-		return
+		return PullRequest{}, AssignmentReport{}, err
 	}
 
+	requiredTags := normalizeTags(req.RequiredTags)
+	slots, report, err := planAssignment(req.AuthorID, authorTeam, req.ChangedFiles, requiredTags)
+	if err != nil {
+		return PullRequest{}, AssignmentReport{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return PullRequest{}, AssignmentReport{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
 	// Create PR
 	var createdAt time.Time
-	err = db.QueryRow(`
-		INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status, created_at)
-		VALUES ($1, $2, $3, 'OPEN', CURRENT_TIMESTAMP)
+	err = tx.QueryRow(`
+		INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status, created_at, required_tags)
+		VALUES ($1, $2, $3, 'OPEN', CURRENT_TIMESTAMP, $4)
 		RETURNING created_at
-	`, req.PullRequestID, req.PullRequestName, req.AuthorID).Scan(&createdAt)
+	`, req.PullRequestID, req.PullRequestName, req.AuthorID, pq.Array(requiredTags)).Scan(&createdAt)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return PullRequest{}, AssignmentReport{}, err
 	}
 
-	// Get active team members (excluding author) for reviewer assignment
-	reviewers := getActiveTeamMembers(authorTeam, req.AuthorID)
+	if req.Forge != nil {
+		_, err = tx.Exec(`
+			INSERT INTO forge_pull_requests (pull_request_id, forge, repository, number)
+			VALUES ($1, $2, $3, $4)
+		`, req.PullRequestID, req.Forge.Forge, req.Forge.Repository, req.Forge.Number)
+		if err != nil {
+			return PullRequest{}, AssignmentReport{}, err
+		}
+	}
 
-	// Assign up to 2 reviewers randomly
-	assignedReviewers := assignReviewers(reviewers, 2)
+	// Lock the chosen reviewers and count their reviews again, so concurrent creates
+	// cannot both fill the last slot of someone at max_open_reviews. A reviewer who
+	// filled up meanwhile triggers a new plan; the last attempt leaves the slot empty.
+	for attempt := 1; ; attempt++ {
+		userIDs := make([]string, len(slots))
+		for i, slot := range slots {
+			userIDs[i] = slot.UserID
+		}
+		atCapacity, err := lockAtCapacity(tx, userIDs)
+		if err != nil {
+			return PullRequest{}, AssignmentReport{}, err
+		}
+		if len(atCapacity) == 0 {
+			break
+		}
+		if attempt == assignmentAttempts {
+			full := map[string]bool{}
+			for _, userID := range atCapacity {
+				full[userID] = true
+			}
+			kept := []ReviewerSlot{}
+			for _, slot := range slots {
+				if !full[slot.UserID] {
+					kept = append(kept, slot)
+				}
+			}
+			slots = kept
+			report.UnfilledSlots = reviewersPerPR - len(slots)
+			report.UnfilledReason = unfilledAtCapacity
+			break
+		}
+		slots, report, err = planAssignment(req.AuthorID, authorTeam, req.ChangedFiles, requiredTags)
+		if err != nil {
+			return PullRequest{}, AssignmentReport{}, err
+		}
+	}
 
 	// Insert reviewers
-	for _, reviewerID := range assignedReviewers {
-		_, err = db.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ($1, $2)", req.PullRequestID, reviewerID)
+	assignedReviewers := []string{}
+	for _, slot := range slots {
+		_, err = tx.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id, assignment_reason, fallback_team) VALUES ($1, $2, $3, NULLIF($4, ''))",
+			req.PullRequestID, slot.UserID, slot.Reason, slot.FallbackTeam)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return PullRequest{}, AssignmentReport{}, err
 		}
+		err = recordEvent(tx, EventReviewerAssigned, []string{slot.UserID}, EventPayload{
+			PullRequestID: req.PullRequestID,
+			AuthorID:      req.AuthorID,
+			UserID:        slot.UserID,
+		})
+		if err != nil {
+			return PullRequest{}, AssignmentReport{}, err
+		}
+		assignedReviewers = append(assignedReviewers, slot.UserID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PullRequest{}, AssignmentReport{}, err
 	}
 
 	createdAtStr := createdAt.Format(time.RFC3339)
-	pr := PullRequest{
+	return PullRequest{
 		PullRequestID:     req.PullRequestID,
 		PullRequestName:   req.PullRequestName,
 		AuthorID:          req.AuthorID,
 		Status:            "OPEN",
 		AssignedReviewers: assignedReviewers,
+		ReviewerSlots:     slots,
+		RequiredTags:      requiredTags,
 		CreatedAt:         &createdAtStr,
+	}, report, nil
+}
+
+// planAssignment selects the reviewers for a new PR by authorID without writing anything:
+// the author's team first, then its fallback teams, ranked by code ownership of
+// changedFiles, requiredTags and working hours, honouring caps, the team's seniority
+// rule and pairing constraints
+func planAssignment(authorID, authorTeam string, changedFiles, requiredTags []string) ([]ReviewerSlot, AssignmentReport, error) {
+	// Get active team members (excluding author) for reviewer assignment
+	reviewers, atCapacity, err := splitByCapacity(db, getActiveTeamMembers(authorTeam, authorID))
+	if err != nil {
+		return nil, AssignmentReport{}, err
+	}
+
+	// Prefer code owners of the changed files, then those inside working hours
+	var owners map[string]bool
+	var matchedRules []CodeOwnerRule
+	if len(changedFiles) > 0 {
+		owners, matchedRules, err = codeOwnersFor(authorTeam, changedFiles)
+		if err != nil {
+			return nil, AssignmentReport{}, err
+		}
+	}
+	tiersFor := func(candidates []string) []candidateTier {
+		tiers := rankByTags(db, workingHoursTiers(db, candidates), requiredTags)
+		if owners != nil {
+			tiers = preferTiers(tiers, owners, reasonCodeOwner)
+		}
+		return tiers
+	}
+
+	report := AssignmentReport{MatchedRules: matchedRules}
+	slots := []ReviewerSlot{}
+	exclude := []string{authorID}
+
+	// The first slot goes to someone satisfying the team's seniority rule, if it has one
+	minSeniority, err := minReviewerSeniority(db, authorTeam)
+	if err != nil {
+		return nil, AssignmentReport{}, err
+	}
+	ruleSlotCount := 0
+	if minSeniority != "" {
+		ruleSlots, ruleAtCapacity, err := fillFromTeamAndFallbacks(db, authorTeam, authorID, reviewers, exclude, 1, seniorTiers(db, tiersFor, minSeniority))
+		if err != nil {
+			return nil, AssignmentReport{}, err
+		}
+		if len(ruleSlots) == 0 {
+			report.UnsatisfiedRules = append(report.UnsatisfiedRules, seniorityRuleReason(minSeniority))
+		}
+		ruleSlotCount = len(ruleSlots)
+		slots = append(slots, ruleSlots...)
+		atCapacity = append(atCapacity, ruleAtCapacity...)
+	}
+
+	// Assign up to 2 reviewers, borrowing from fallback teams when the author's team runs out
+	for _, slot := range slots {
+		exclude = append(exclude, slot.UserID)
+	}
+	moreSlots, fallbackAtCapacity, err := fillFromTeamAndFallbacks(db, authorTeam, authorID, reviewers, exclude, reviewersPerPR-len(slots), tiersFor)
+	if err != nil {
+		return nil, AssignmentReport{}, err
+	}
+	slots = append(slots, moreSlots...)
+	atCapacity = append(atCapacity, fallbackAtCapacity...)
+
+	// Break up the reviewer pair of the author's previous PR if the team avoids repeats.
+	// The last slot is swapped; when that is the reviewer picked for the seniority rule,
+	// only someone who also satisfies the rule may replace them.
+	previousPair, err := previousReviewerPair(authorTeam, authorID)
+	if err != nil {
+		return nil, AssignmentReport{}, err
+	}
+	if sameReviewers(slots, previousPair) {
+		swapTiers := tiersFor
+		if len(slots) <= ruleSlotCount {
+			swapTiers = seniorTiers(db, tiersFor, minSeniority)
+		}
+		pairExclude := append([]string{authorID}, previousPair...)
+		alternatives, _, err := fillFromTeamAndFallbacks(db, authorTeam, authorID, reviewers, pairExclude, 1, swapTiers)
+		if err != nil {
+			return nil, AssignmentReport{}, err
+		}
+		if len(alternatives) > 0 {
+			alternative := alternatives[0]
+			alternative.Reason = reasonAvoidedRepeatPair + "; " + alternative.Reason
+			slots[len(slots)-1] = alternative
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{"pr": pr}); err != nil {
-		log.Printf("Error encoding response: %v", err)
+	report.UnfilledSlots = reviewersPerPR - len(slots)
+	if report.UnfilledSlots > 0 {
+		report.UnfilledReason = unfilledNotEnoughMembers
+		if len(atCapacity) > 0 {
+			report.UnfilledReason = unfilledAtCapacity
+		}
 	}
+
+	return slots, report, nil
 }
 
 func pullRequestMergeHandler(w http.ResponseWriter, r *http.Request) {
@@ -409,42 +995,135 @@ func pullRequestMergeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if PR exists
-	var status string
-	var mergedAt sql.NullTime
-	err := db.QueryRow("SELECT status, merged_at FROM pull_requests WHERE pull_request_id = $1", req.PullRequestID).Scan(&status, &mergedAt)
+	pr, err := mergePullRequest(req.PullRequestID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"pr": pr}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// mergePullRequest marks the PR as MERGED. Merging an already merged PR returns its current state.
+func mergePullRequest(prID string) (PullRequest, error) {
+	tx, err := db.Begin()
 	if err != nil {
+		return PullRequest{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	// Update PR to MERGED. Only the merge that flips an OPEN PR records the event, so
+	// concurrent merges cannot both notify.
+	var authorID string
+	err = tx.QueryRow("UPDATE pull_requests SET status = 'MERGED', merged_at = CURRENT_TIMESTAMP WHERE pull_request_id = $1 AND status = 'OPEN' RETURNING author_id", prID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		var status string
+		err := tx.QueryRow("SELECT status FROM pull_requests WHERE pull_request_id = $1", prID).Scan(&status)
 		if err == sql.ErrNoRows {
-			sendError(w, http.StatusNotFound, "NOT_FOUND", "PR not found")
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return PullRequest{}, &apiError{http.StatusNotFound, "NOT_FOUND", "PR not found", ""}
 		}
-		return
+		if err != nil {
+			return PullRequest{}, err
+		}
+		if status == "CLOSED" {
+			return PullRequest{}, &apiError{http.StatusConflict, "PR_CLOSED", "cannot merge closed PR", ""}
+		}
+		// Idempotent: if already merged, return current state
+		return getPullRequest(prID), nil
+	}
+	if err != nil {
+		return PullRequest{}, err
 	}
 
-	// Idempotent: if already merged, return current state
-	if status == "MERGED" {
-		pr := getPullRequest(req.PullRequestID)
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(map[string]interface{}{"pr": pr}); err != nil {
-			log.Printf("Error encoding response: %v", err)
+	reviewers := getCurrentReviewers(tx, prID)
+	err = recordEvent(tx, EventPullRequestMerged, reviewers, EventPayload{
+		PullRequestID:     prID,
+		AuthorID:          authorID,
+		AssignedReviewers: reviewers,
+	})
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PullRequest{}, err
+	}
+
+	return getPullRequest(prID), nil
+}
+
+// closePullRequest marks an OPEN PR as CLOSED without merging. Its reviewers stay
+// assigned for a reopen but stop counting as open reviews. Closing a PR that is not
+// OPEN returns its current state.
+func closePullRequest(prID string) (PullRequest, error) {
+	return changePullRequestStatus(prID, "OPEN", "CLOSED", "closed_at = CURRENT_TIMESTAMP", EventPullRequestClosed)
+}
+
+// reopenPullRequest restores a CLOSED PR to OPEN with the reviewers it had.
+// Reopening a PR that is not CLOSED returns its current state.
+func reopenPullRequest(prID string) (PullRequest, error) {
+	return changePullRequestStatus(prID, "CLOSED", "OPEN", "closed_at = NULL", EventPullRequestReopened)
+}
+
+// changePullRequestStatus moves a PR from one status to another and records eventType
+// for its reviewers. Only the call that makes the change records the event.
+func changePullRequestStatus(prID, from, to, setColumns, eventType string) (PullRequest, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return PullRequest{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
 		}
-		return
+	}()
+
+	var authorID string
+	err = tx.QueryRow("UPDATE pull_requests SET status = $1, "+setColumns+" WHERE pull_request_id = $2 AND status = $3 RETURNING author_id", to, prID, from).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM pull_requests WHERE pull_request_id = $1)", prID).Scan(&exists); err != nil {
+			return PullRequest{}, err
+		}
+		if !exists {
+			return PullRequest{}, &apiError{http.StatusNotFound, "NOT_FOUND", "PR not found", ""}
+		}
+		return getPullRequest(prID), nil
+	}
+	if err != nil {
+		return PullRequest{}, err
 	}
 
-	// Update PR to MERGED
-	var newMergedAt time.Time
-	err = db.QueryRow("UPDATE pull_requests SET status = 'MERGED', merged_at = CURRENT_TIMESTAMP WHERE pull_request_id = $1 RETURNING merged_at", req.PullRequestID).Scan(&newMergedAt)
+	reviewers := getCurrentReviewers(tx, prID)
+	err = recordEvent(tx, eventType, reviewers, EventPayload{
+		PullRequestID:     prID,
+		AuthorID:          authorID,
+		AssignedReviewers: reviewers,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return PullRequest{}, err
 	}
 
-	pr := getPullRequest(req.PullRequestID)
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{"pr": pr}); err != nil {
-		log.Printf("Error encoding response: %v", err)
+	if err := tx.Commit(); err != nil {
+		return PullRequest{}, err
 	}
+
+	return getPullRequest(prID), nil
+}
+
+// PullRequestReassignRequest is the body of /pullRequest/reassign
+type PullRequestReassignRequest struct {
+	PullRequestID string `json:"pull_request_id"`
+	OldUserID     string `json:"old_user_id"`
+	// NewUserID picks the replacement explicitly instead of selecting one randomly
+	NewUserID string `json:"new_user_id,omitempty"`
 }
 
 func pullRequestReassignHandler(w http.ResponseWriter, r *http.Request) {
@@ -453,96 +1132,152 @@ func pullRequestReassignHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		PullRequestID string `json:"pull_request_id"`
-		OldUserID     string `json:"old_user_id"`
-	}
-
+	var req PullRequestReassignRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	pr, newReviewerID, err := reassignReviewer(req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"pr":          pr,
+		"replaced_by": newReviewerID,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// reassignReviewer replaces one reviewer of an OPEN PR with a random active member
+// of the replaced reviewer's team, or with req.NewUserID when given, and returns the
+// updated PR and the new reviewer
+func reassignReviewer(req PullRequestReassignRequest) (PullRequest, string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return PullRequest{}, "", err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	newReviewerID, err := reassignReviewerTx(tx, req)
+	if err != nil {
+		return PullRequest{}, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PullRequest{}, "", err
+	}
+
+	return getPullRequest(req.PullRequestID), newReviewerID, nil
+}
+
+// reassignReviewerTx is reassignReviewer within the caller's transaction. The PR row
+// is locked so concurrent changes to its reviewers are applied one after the other.
+func reassignReviewerTx(q dbExecutor, req PullRequestReassignRequest) (string, error) {
 	// Check if PR exists and get status
 	var status string
-	err := db.QueryRow("SELECT status FROM pull_requests WHERE pull_request_id = $1", req.PullRequestID).Scan(&status)
+	err := q.QueryRow("SELECT status FROM pull_requests WHERE pull_request_id = $1 FOR UPDATE", req.PullRequestID).Scan(&status)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			sendError(w, http.StatusNotFound, "NOT_FOUND", "PR not found")
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return "", &apiError{http.StatusNotFound, "NOT_FOUND", "PR not found", ""}
 		}
-		return
+		return "", err
 	}
 
-	// Check if PR is merged
+	// Check if PR is merged or closed
 	if status == "MERGED" {
-		sendError(w, http.StatusConflict, "PR_MERGED", "cannot reassign on merged PR")
-		return
+		return "", &apiError{http.StatusConflict, "PR_MERGED", "cannot reassign on merged PR", ""}
+	}
+	if status == "CLOSED" {
+		return "", &apiError{http.StatusConflict, "PR_CLOSED", "cannot reassign on closed PR", ""}
 	}
 
 	// Check if old user is assigned as reviewer
 	var isAssigned bool
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM pr_reviewers WHERE pull_request_id = $1 AND user_id = $2)", req.PullRequestID, req.OldUserID).Scan(&isAssigned)
+	err = q.QueryRow("SELECT EXISTS(SELECT 1 FROM pr_reviewers WHERE pull_request_id = $1 AND user_id = $2)", req.PullRequestID, req.OldUserID).Scan(&isAssigned)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
 	if !isAssigned {
-		sendError(w, http.StatusConflict, "NOT_ASSIGNED", "reviewer is not assigned to this PR")
-		return
+		return "", &apiError{http.StatusConflict, "NOT_ASSIGNED", "reviewer is not assigned to this PR", ""}
 	}
 
 	// Get old reviewer's team
 	var oldReviewerTeam string
-	err = db.QueryRow("SELECT team_name FROM users WHERE user_id = $1", req.OldUserID).Scan(&oldReviewerTeam)
+	err = q.QueryRow("SELECT team_name FROM users WHERE user_id = $1", req.OldUserID).Scan(&oldReviewerTeam)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
-	// Get author ID to exclude from candidates
-	var authorID string
-	err = db.QueryRow("SELECT author_id FROM pull_requests WHERE pull_request_id = $1", req.PullRequestID).Scan(&authorID)
+	// Get author ID to exclude from candidates, the author's team and the skills the PR asked for
+	var authorID, authorTeam string
+	var requiredTags []string
+	err = q.QueryRow(`
+		SELECT pr.author_id, u.team_name, pr.required_tags
+		FROM pull_requests pr
+		JOIN users u ON u.user_id = pr.author_id
+		WHERE pr.pull_request_id = $1
+	`, req.PullRequestID).Scan(&authorID, &authorTeam, pq.Array(&requiredTags))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return "", err
 	}
-
 	// Get currently assigned reviewers to exclude
-	currentReviewers := getCurrentReviewers(req.PullRequestID)
+	currentReviewers := getCurrentReviewers(q, req.PullRequestID)
 
-	// Get active team members from old reviewer's team (excluding author and current reviewers)
-	candidates := getActiveTeamMembersExcluding(oldReviewerTeam, append(currentReviewers, authorID))
+	rc := replacementContext{
+		OldUserID:        req.OldUserID,
+		OldReviewerTeam:  oldReviewerTeam,
+		AuthorID:         authorID,
+		AuthorTeam:       authorTeam,
+		RequiredTags:     requiredTags,
+		CurrentReviewers: currentReviewers,
+	}
 
-	if len(candidates) == 0 {
-		sendError(w, http.StatusConflict, "NO_CANDIDATE", "no active replacement candidate in team")
-		return
+	var slot ReviewerSlot
+	if req.NewUserID != "" {
+		if err := validateChosenReviewer(q, req.NewUserID, rc); err != nil {
+			return "", err
+		}
+		slot = ReviewerSlot{UserID: req.NewUserID, Reason: reasonChosenExplicitly}
+	} else {
+		slot, err = selectReplacement(q, rc)
+		if err != nil {
+			return "", err
+		}
 	}
+	newReviewerID := slot.UserID
 
-	// Randomly select a new reviewer using crypto/rand for security
-	newReviewerID, err := selectRandomCandidate(candidates)
-	if err != nil {
-		http.Error(w, "Failed to select reviewer", http.StatusInternalServerError)
-		return
+	if err := archiveReviewers(q, []string{req.PullRequestID}, []string{req.OldUserID}); err != nil {
+		return "", err
 	}
 
 	// Replace reviewer
-	_, err = db.Exec("UPDATE pr_reviewers SET user_id = $1 WHERE pull_request_id = $2 AND user_id = $3", newReviewerID, req.PullRequestID, req.OldUserID)
+	_, err = q.Exec("UPDATE pr_reviewers SET user_id = $1, assignment_reason = $2, fallback_team = NULLIF($3, ''), "+reviewerResetColumns+" WHERE pull_request_id = $4 AND user_id = $5",
+		newReviewerID, slot.Reason, slot.FallbackTeam, req.PullRequestID, req.OldUserID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
-	pr := getPullRequest(req.PullRequestID)
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"pr":          pr,
-		"replaced_by": newReviewerID,
-	}); err != nil {
-		log.Printf("Error encoding response: %v", err)
+	err = recordEvent(q, EventReviewerReassigned, []string{req.OldUserID, newReviewerID}, EventPayload{
+		PullRequestID: req.PullRequestID,
+		AuthorID:      authorID,
+		OldUserID:     req.OldUserID,
+		NewUserID:     newReviewerID,
+	})
+	if err != nil {
+		return "", err
 	}
+
+	return newReviewerID, nil
 }
 
 func usersGetReviewHandler(w http.ResponseWriter, r *http.Request) {
@@ -626,97 +1361,18 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func statsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	type UserStats struct {
-		UserID         string `json:"user_id"`
-		Username       string `json:"username"`
-		ReviewCount    int    `json:"review_count"`
-		AuthoredPRs    int    `json:"authored_prs"`
-		OpenReviews    int    `json:"open_reviews"`
-		MergedReviews  int    `json:"merged_reviews"`
-	}
-
-	type Stats struct {
-		TotalTeams       int         `json:"total_teams"`
-		TotalUsers       int         `json:"total_users"`
-		ActiveUsers      int         `json:"active_users"`
-		TotalPRs         int         `json:"total_prs"`
-		OpenPRs          int         `json:"open_prs"`
-		MergedPRs        int         `json:"merged_prs"`
-		TopReviewers     []UserStats `json:"top_reviewers"`
-	}
-
-	var stats Stats
-
-	// Get totals
-	if err := db.QueryRow("SELECT COUNT(*) FROM teams").Scan(&stats.TotalTeams); err != nil {
-		log.Printf("Error getting total teams: %v", err)
-	}
-	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&stats.TotalUsers); err != nil {
-		log.Printf("Error getting total users: %v", err)
-	}
-	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE is_active = true").Scan(&stats.ActiveUsers); err != nil {
-		log.Printf("Error getting active users: %v", err)
-	}
-	if err := db.QueryRow("SELECT COUNT(*) FROM pull_requests").Scan(&stats.TotalPRs); err != nil {
-		log.Printf("Error getting total PRs: %v", err)
-	}
-	if err := db.QueryRow("SELECT COUNT(*) FROM pull_requests WHERE status = 'OPEN'").Scan(&stats.OpenPRs); err != nil {
-		log.Printf("Error getting open PRs: %v", err)
-	}
-	if err := db.QueryRow("SELECT COUNT(*) FROM pull_requests WHERE status = 'MERGED'").Scan(&stats.MergedPRs); err != nil {
-		log.Printf("Error getting merged PRs: %v", err)
-	}
-
-	// Get top reviewers
-	rows, err := db.Query(`
-		SELECT 
-			u.user_id,
-			u.username,
-			COUNT(DISTINCT r.pull_request_id) as review_count,
-			COUNT(DISTINCT pr_authored.pull_request_id) as authored_prs,
-			COUNT(DISTINCT CASE WHEN pr.status = 'OPEN' THEN r.pull_request_id END) as open_reviews,
-			COUNT(DISTINCT CASE WHEN pr.status = 'MERGED' THEN r.pull_request_id END) as merged_reviews
-		FROM users u
-		LEFT JOIN pr_reviewers r ON u.user_id = r.user_id
-		LEFT JOIN pull_requests pr ON r.pull_request_id = pr.pull_request_id
-		LEFT JOIN pull_requests pr_authored ON u.user_id = pr_authored.author_id
-		GROUP BY u.user_id, u.username
-		ORDER BY review_count DESC
-		LIMIT 10
-	`)
-	if err == nil {
-		defer func() {
-			if err := rows.Close(); err != nil {
-				log.Printf("Error closing rows: %v", err)
-			}
-		}()
-		for rows.Next() {
-			var us UserStats
-			if err := rows.Scan(&us.UserID, &us.Username, &us.ReviewCount, &us.AuthoredPRs, &us.OpenReviews, &us.MergedReviews); err != nil {
-				log.Printf("Error scanning user stats: %v", err)
-				continue
-			}
-			stats.TopReviewers = append(stats.TopReviewers, us)
-		}
-	}
-
-	if stats.TopReviewers == nil {
-		stats.TopReviewers = []UserStats{}
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(stats); err != nil {
-		log.Printf("Error encoding response: %v", err)
-	}
+// userReassignmentCounts is how a team deactivation changed one user's open reviews
+type userReassignmentCounts struct {
+	// Reassigned reviews were handed to someone else
+	Reassigned int `json:"reassigned"`
+	// Unassigned reviews were dropped because nobody could take them
+	Unassigned int `json:"unassigned"`
+	// Received reviews were taken over from a deactivated user
+	Received int `json:"received"`
 }
 
-// teamDeactivateHandler handles mass deactivation of team members and reassigns their open PRs
+// teamDeactivateHandler handles mass deactivation of team members and reassigns their open PRs.
+// Replacements come from the team itself only, see reassignDeactivatedReviews.
 func teamDeactivateHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -725,6 +1381,12 @@ func teamDeactivateHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		TeamName string `json:"team_name"`
+		// UserIDs deactivates only these members instead of the whole team
+		UserIDs []string `json:"user_ids"`
+		// Filter deactivates only the members matching it
+		Filter *deactivationFilter `json:"filter"`
+		// DryRun plans the deactivation in the same transaction and rolls it back
+		DryRun bool `json:"dry_run"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -745,6 +1407,32 @@ func teamDeactivateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(req.UserIDs) > 0 && req.Filter != nil {
+		http.Error(w, "user_ids and filter are mutually exclusive", http.StatusBadRequest)
+		return
+	}
+	var userIDs, filterTags []string
+	filterSeniority := ""
+	if len(req.UserIDs) > 0 {
+		if err := checkTeamMembers(req.TeamName, req.UserIDs); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		userIDs = req.UserIDs
+	}
+	if req.Filter != nil {
+		filterSeniority = req.Filter.Seniority
+		filterTags = normalizeTags(req.Filter.Tags)
+		if filterSeniority == "" && len(filterTags) == 0 {
+			http.Error(w, "filter must set seniority or tags", http.StatusBadRequest)
+			return
+		}
+		if filterSeniority != "" && seniorityRank(filterSeniority) == 0 {
+			http.Error(w, "filter.seniority must be one of "+strings.Join(seniorityLevels, ", "), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Start transaction for atomicity
 	tx, err := db.Begin()
 	if err != nil {
@@ -757,8 +1445,14 @@ func teamDeactivateHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	// Get all active users in the team
-	rows, err := tx.Query("SELECT user_id FROM users WHERE team_name = $1 AND is_active = true", req.TeamName)
+	// Get the active users of the team selected by user_ids or the filter, all of them by default
+	rows, err := tx.Query(`
+		SELECT user_id FROM users
+		WHERE team_name = $1 AND is_active = true
+			AND ($2::text[] IS NULL OR user_id = ANY($2))
+			AND ($3 = '' OR seniority = $3)
+			AND ($4::text[] IS NULL OR tags @> $4)
+	`, req.TeamName, pq.Array(userIDs), filterSeniority, pq.Array(filterTags))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -779,120 +1473,14 @@ func teamDeactivateHandler(w http.ResponseWriter, r *http.Request) {
 		usersToDeactivate = append(usersToDeactivate, userID)
 	}
 
-	// Track reassignments for response
-	type Reassignment struct {
-		PRID        string `json:"pr_id"`
-		OldReviewer string `json:"old_reviewer"`
-		NewReviewer string `json:"new_reviewer"`
-	}
-	var reassignments []Reassignment
-	var failedReassignments []string
-
-	// Process each user's open PR reviews
-	for _, userID := range usersToDeactivate {
-		// Get all OPEN PRs where this user is a reviewer
-		prRows, err := tx.Query(`
-			SELECT pr.pull_request_id, pr.author_id
-			FROM pull_requests pr
-			JOIN pr_reviewers r ON pr.pull_request_id = r.pull_request_id
-			WHERE r.user_id = $1 AND pr.status = 'OPEN'
-		`, userID)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		
-		var prsToReassign []struct {
-			PRID     string
-			AuthorID string
-		}
-		func() {
-			defer func() {
-				if err := prRows.Close(); err != nil {
-					log.Printf("Error closing rows: %v", err)
-				}
-			}()
-
-			for prRows.Next() {
-				var pr struct {
-					PRID     string
-					AuthorID string
-				}
-				if err := prRows.Scan(&pr.PRID, &pr.AuthorID); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				prsToReassign = append(prsToReassign, pr)
-			}
-		}()
-
-		// Reassign each PR
-		for _, pr := range prsToReassign {
-			// Get current reviewers for this PR
-			var currentReviewers []string
-			func() {
-				revRows, err := tx.Query("SELECT user_id FROM pr_reviewers WHERE pull_request_id = $1", pr.PRID)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				defer func() {
-					if err := revRows.Close(); err != nil {
-						log.Printf("Error closing rows: %v", err)
-					}
-				}()
-
-				for revRows.Next() {
-					var revID string
-					if err := revRows.Scan(&revID); err != nil {
-						http.Error(w, err.Error(), http.StatusInternalServerError)
-						return
-					}
-					currentReviewers = append(currentReviewers, revID)
-				}
-			}()
-
-			// Find replacement from the same team (excluding current reviewers and author)
-			excludeList := append(currentReviewers, pr.AuthorID)
-			
-			// Build query to find active replacement from same team
-			query := `SELECT user_id FROM users 
-				WHERE team_name = $1 AND is_active = true AND user_id != ALL($2)
-				LIMIT 1`
-			
-			var newReviewerID string
-			err = tx.QueryRow(query, req.TeamName, excludeList).Scan(&newReviewerID)
-			
-			if err == sql.ErrNoRows {
-				// No replacement available - just remove the reviewer
-				_, err = tx.Exec("DELETE FROM pr_reviewers WHERE pull_request_id = $1 AND user_id = $2", pr.PRID, userID)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				failedReassignments = append(failedReassignments, pr.PRID)
-			} else if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			} else {
-				// Replace the reviewer
-				_, err = tx.Exec("UPDATE pr_reviewers SET user_id = $1 WHERE pull_request_id = $2 AND user_id = $3", 
-					newReviewerID, pr.PRID, userID)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				reassignments = append(reassignments, Reassignment{
-					PRID:        pr.PRID,
-					OldReviewer: userID,
-					NewReviewer: newReviewerID,
-				})
-			}
-		}
+	// Deactivate them first so replacements only come from the members who stay active.
+	// Deactivating the whole team counts every member, as it always has.
+	var result sql.Result
+	if userIDs == nil && req.Filter == nil {
+		result, err = tx.Exec("UPDATE users SET is_active = false WHERE team_name = $1", req.TeamName)
+	} else {
+		result, err = tx.Exec("UPDATE users SET is_active = false WHERE user_id = ANY($1)", pq.Array(usersToDeactivate))
 	}
-
-	// Deactivate all users in the team
-	result, err := tx.Exec("UPDATE users SET is_active = false WHERE team_name = $1", req.TeamName)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -900,18 +1488,49 @@ func teamDeactivateHandler(w http.ResponseWriter, r *http.Request) {
 
 	deactivatedCount, _ := result.RowsAffected()
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
+	// Plan the moves in memory and apply them with a few set-based statements
+	reassignments, failed, err := reassignDeactivatedReviews(tx, req.TeamName, usersToDeactivate)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if reassignments == nil {
+		reassignments = []Reassignment{}
+	}
+	failedReassignments := []string{}
+	perUser := map[string]*userReassignmentCounts{}
+	countsFor := func(userID string) *userReassignmentCounts {
+		if perUser[userID] == nil {
+			perUser[userID] = &userReassignmentCounts{}
+		}
+		return perUser[userID]
+	}
+	for _, move := range reassignments {
+		countsFor(move.OldReviewer).Reassigned++
+		countsFor(move.NewReviewer).Received++
+	}
+	for _, review := range failed {
+		failedReassignments = append(failedReassignments, review.PRID)
+		countsFor(review.UserID).Unassigned++
+	}
+
+	// Commit transaction, or leave it to the deferred rollback on a dry run
+	if !req.DryRun {
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
 		"team_name":             req.TeamName,
 		"deactivated_count":     deactivatedCount,
 		"reassignments":         reassignments,
 		"failed_reassignments":  failedReassignments,
+		"per_user":              perUser,
+		"dry_run":               req.DryRun,
 	}); err != nil {
 		log.Printf("Error encoding response: %v", err)
 	}
@@ -919,19 +1538,65 @@ func teamDeactivateHandler(w http.ResponseWriter, r *http.Request) {
 
 // Helper functions
 
+// envInt reads an integer setting from the environment, falling back to def
+func envInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envDuration reads a duration setting (e.g. "30s") from the environment, falling back to def
+func envDuration(name string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// apiError is a domain error returned by the service functions; handlers render it with sendError
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+	// Reason optionally narrows down Code, e.g. why no candidate was found
+	Reason string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// writeServiceError renders an apiError as an ErrorResponse and anything else as a 500
+func writeServiceError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		writeError(w, apiErr.Status, apiErr.Code, apiErr.Message, apiErr.Reason)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
 func sendError(w http.ResponseWriter, statusCode int, code, message string) {
+	writeError(w, statusCode, code, message, "")
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code, message, reason string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	var errResp ErrorResponse
 	errResp.Error.Code = code
 	errResp.Error.Message = message
+	errResp.Error.Reason = reason
 	if err := json.NewEncoder(w).Encode(errResp); err != nil {
 		log.Printf("Error encoding error response: %v", err)
 	}
 }
 
 func getActiveTeamMembers(teamName, excludeUserID string) []string {
-	rows, err := db.Query("SELECT user_id FROM users WHERE team_name = $1 AND is_active = true AND user_id != $2", teamName, excludeUserID)
+	rows, err := db.Query("SELECT user_id FROM users WHERE team_name = $1 AND is_active = true AND user_id != $2 AND "+notAbsentCondition+" AND "+notPairedCondition("$2"), teamName, excludeUserID)
 	if err != nil {
 		return []string{}
 	}
@@ -952,9 +1617,11 @@ func getActiveTeamMembers(teamName, excludeUserID string) []string {
 	return members
 }
 
-func getActiveTeamMembersExcluding(teamName string, excludeUserIDs []string) []string {
+// getActiveTeamMembersExcluding returns active, present members of teamName who may review
+// authorID's PRs, except excludeUserIDs
+func getActiveTeamMembersExcluding(q dbExecutor, teamName, authorID string, excludeUserIDs []string) []string {
 	if len(excludeUserIDs) == 0 {
-		rows, err := db.Query("SELECT user_id FROM users WHERE team_name = $1 AND is_active = true", teamName)
+		rows, err := q.Query("SELECT user_id FROM users WHERE team_name = $1 AND is_active = true AND "+notAbsentCondition+" AND "+notPairedCondition("$2"), teamName, authorID)
 		if err != nil {
 			return []string{}
 		}
@@ -976,18 +1643,18 @@ func getActiveTeamMembersExcluding(teamName string, excludeUserIDs []string) []s
 	}
 
 	// Build query with placeholders for excluded IDs
-	query := "SELECT user_id FROM users WHERE team_name = $1 AND is_active = true AND user_id NOT IN ("
-	args := []interface{}{teamName}
+	query := "SELECT user_id FROM users WHERE team_name = $1 AND is_active = true AND " + notAbsentCondition + " AND " + notPairedCondition("$2") + " AND user_id NOT IN ("
+	args := []interface{}{teamName, authorID}
 	for i, id := range excludeUserIDs {
 		if i > 0 {
 			query += ", "
 		}
-		query += "$" + fmt.Sprintf("%d", i+2)
+		query += "$" + fmt.Sprintf("%d", i+3)
 		args = append(args, id)
 	}
 	query += ")"
 
-	rows, err := db.Query(query, args...)
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return []string{}
 	}
@@ -1043,8 +1710,8 @@ func selectRandomCandidate(candidates []string) (string, error) {
 	return candidates[n.Int64()], nil
 }
 
-func getCurrentReviewers(prID string) []string {
-	rows, err := db.Query("SELECT user_id FROM pr_reviewers WHERE pull_request_id = $1", prID)
+func getCurrentReviewers(q dbExecutor, prID string) []string {
+	rows, err := q.Query("SELECT user_id FROM pr_reviewers WHERE pull_request_id = $1", prID)
 	if err != nil {
 		return []string{}
 	}
@@ -1065,15 +1732,38 @@ func getCurrentReviewers(prID string) []string {
 	return reviewers
 }
 
+// getReviewerSlots returns the PR's reviewers with the reason each was assigned
+func getReviewerSlots(prID string) []ReviewerSlot {
+	slots := []ReviewerSlot{}
+	rows, err := db.Query("SELECT user_id, COALESCE(assignment_reason, ''), COALESCE(fallback_team, '') FROM pr_reviewers WHERE pull_request_id = $1 ORDER BY user_id", prID)
+	if err != nil {
+		return slots
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var slot ReviewerSlot
+		if err := rows.Scan(&slot.UserID, &slot.Reason, &slot.FallbackTeam); err != nil {
+			continue
+		}
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
 func getPullRequest(prID string) PullRequest {
 	var pr PullRequest
 	var createdAt, mergedAt sql.NullTime
 
 	err := db.QueryRow(`
-		SELECT pull_request_id, pull_request_name, author_id, status, created_at, merged_at
+		SELECT pull_request_id, pull_request_name, author_id, status, created_at, merged_at, required_tags
 		FROM pull_requests
 		WHERE pull_request_id = $1
-	`, prID).Scan(&pr.PullRequestID, &pr.PullRequestName, &pr.AuthorID, &pr.Status, &createdAt, &mergedAt)
+	`, prID).Scan(&pr.PullRequestID, &pr.PullRequestName, &pr.AuthorID, &pr.Status, &createdAt, &mergedAt, pq.Array(&pr.RequiredTags))
 
 	if err != nil {
 		return pr
@@ -1089,9 +1779,10 @@ func getPullRequest(prID string) PullRequest {
 		pr.MergedAt = &mergedAtStr
 	}
 
-	pr.AssignedReviewers = getCurrentReviewers(prID)
-	if pr.AssignedReviewers == nil {
-		pr.AssignedReviewers = []string{}
+	pr.ReviewerSlots = getReviewerSlots(prID)
+	pr.AssignedReviewers = []string{}
+	for _, slot := range pr.ReviewerSlots {
+		pr.AssignedReviewers = append(pr.AssignedReviewers, slot.UserID)
 	}
 
 	return pr
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// Reasons a candidate was left out of a previewed assignment
+const (
+	excludedAuthor      = "author of the PR"
+	excludedInactive    = "inactive"
+	excludedAbsent      = "absent"
+	excludedNeverPair   = "never_pair constraint with the author"
+	excludedAtCapacity  = "at open review capacity"
+	excludedNotSelected = "eligible but ranked lower or not drawn"
+)
+
+// ExcludedCandidate is a member of the author's team or its fallback teams who was not picked
+type ExcludedCandidate struct {
+	UserID   string `json:"user_id"`
+	TeamName string `json:"team_name"`
+	Reason   string `json:"reason"`
+}
+
+// AssignmentPreview is what /pullRequest/create would assign right now
+type AssignmentPreview struct {
+	Reviewers  []ReviewerSlot      `json:"reviewers"`
+	Assignment AssignmentReport    `json:"assignment"`
+	Excluded   []ExcludedCandidate `json:"excluded"`
+}
+
+// previewAssignment runs the create pipeline for req without writing anything.
+// Selection within a tier is random, so a later create may pick a different,
+// equally ranked reviewer.
+func previewAssignment(req PullRequestCreateRequest) (AssignmentPreview, error) {
+	var authorTeam string
+	err := db.QueryRow("SELECT team_name FROM users WHERE user_id = $1", req.AuthorID).Scan(&authorTeam)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AssignmentPreview{}, &apiError{http.StatusNotFound, "NOT_FOUND", "author not found", ""}
+		}
+		return AssignmentPreview{}, err
+	}
+
+	slots, report, err := planAssignment(req.AuthorID, authorTeam, req.ChangedFiles, normalizeTags(req.RequiredTags))
+	if err != nil {
+		return AssignmentPreview{}, err
+	}
+
+	fallbackTeams, err := loadFallbackTeams(db, authorTeam)
+	if err != nil {
+		return AssignmentPreview{}, err
+	}
+	excluded, err := excludedCandidates(req.AuthorID, append([]string{authorTeam}, fallbackTeams...), slots)
+	if err != nil {
+		return AssignmentPreview{}, err
+	}
+
+	return AssignmentPreview{Reviewers: slots, Assignment: report, Excluded: excluded}, nil
+}
+
+// excludedCandidates explains why every member of teams other than the chosen reviewers
+// was left out, giving the first filter of the pipeline each one failed
+func excludedCandidates(authorID string, teams []string, chosen []ReviewerSlot) ([]ExcludedCandidate, error) {
+	picked := map[string]bool{}
+	for _, slot := range chosen {
+		picked[slot.UserID] = true
+	}
+
+	rows, err := db.Query(`
+		SELECT user_id, team_name, is_active, NOT (`+notAbsentCondition+`), NOT (`+notPairedCondition("$2")+`)
+		FROM users
+		WHERE team_name = ANY($1)
+		ORDER BY array_position($1, team_name::text), user_id
+	`, pq.Array(teams), authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	excluded := []ExcludedCandidate{}
+	var eligible []string
+	for rows.Next() {
+		var candidate ExcludedCandidate
+		var isActive, absent, paired bool
+		if err := rows.Scan(&candidate.UserID, &candidate.TeamName, &isActive, &absent, &paired); err != nil {
+			return nil, err
+		}
+		switch {
+		case picked[candidate.UserID]:
+			continue
+		case candidate.UserID == authorID:
+			candidate.Reason = excludedAuthor
+		case !isActive:
+			candidate.Reason = excludedInactive
+		case absent:
+			candidate.Reason = excludedAbsent
+		case paired:
+			candidate.Reason = excludedNeverPair
+		default:
+			eligible = append(eligible, candidate.UserID)
+		}
+		excluded = append(excluded, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, atCapacity, err := splitByCapacity(db, eligible)
+	if err != nil {
+		return nil, err
+	}
+	full := map[string]bool{}
+	for _, userID := range atCapacity {
+		full[userID] = true
+	}
+	for i := range excluded {
+		if excluded[i].Reason != "" {
+			continue
+		}
+		if full[excluded[i].UserID] {
+			excluded[i].Reason = excludedAtCapacity
+		} else {
+			excluded[i].Reason = excludedNotSelected
+		}
+	}
+	return excluded, nil
+}
+
+func pullRequestPreviewAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PullRequestCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.AuthorID == "" {
+		http.Error(w, "author_id is required", http.StatusBadRequest)
+		return
+	}
+
+	preview, err := previewAssignment(req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(preview); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
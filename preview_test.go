@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestPreviewAssignmentWritesNothing(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', false)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, max_open_reviews) VALUES ('u4', 'Dave', 'backend', true, 0)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u5', 'Eve', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO review_constraints (kind, author_id, reviewer_id) VALUES ('never_pair', 'u1', 'u5')")
+
+	preview, err := previewAssignment(PullRequestCreateRequest{PullRequestID: "pr-1001", AuthorID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Reviewers) != 1 || preview.Reviewers[0].UserID != "u2" {
+		t.Errorf("Expected u2 to be the only reviewer, got %+v", preview.Reviewers)
+	}
+
+	want := map[string]string{"u1": excludedAuthor, "u3": excludedInactive, "u4": excludedAtCapacity, "u5": excludedNeverPair}
+	if len(preview.Excluded) != len(want) {
+		t.Fatalf("Expected %d excluded candidates, got %+v", len(want), preview.Excluded)
+	}
+	for _, candidate := range preview.Excluded {
+		if want[candidate.UserID] != candidate.Reason {
+			t.Errorf("%s: expected %q, got %q", candidate.UserID, want[candidate.UserID], candidate.Reason)
+		}
+	}
+
+	var count int
+	_ = testDB.QueryRow("SELECT COUNT(*) FROM pull_requests").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected preview not to create the PR, found %d", count)
+	}
+}
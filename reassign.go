@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// reasonChosenExplicitly is recorded for a replacement named in new_user_id
+const reasonChosenExplicitly = "chosen explicitly on reassign"
+
+// replacementContext is what choosing a replacement for OldUserID needs to know about the PR
+type replacementContext struct {
+	OldUserID        string
+	OldReviewerTeam  string
+	AuthorID         string
+	AuthorTeam       string
+	RequiredTags     []string
+	CurrentReviewers []string
+}
+
+// selectReplacement picks a replacement from the old reviewer's team, or from its
+// fallback teams when the team has nobody left, honouring the author's team seniority rule
+func selectReplacement(q dbExecutor, rc replacementContext) (ReviewerSlot, error) {
+	tiersFor := func(candidates []string) []candidateTier {
+		return rankByTags(q, workingHoursTiers(q, candidates), rc.RequiredTags)
+	}
+
+	// If the old reviewer is the only one satisfying the author's team seniority rule,
+	// the replacement has to satisfy it too
+	minSeniority, err := minReviewerSeniority(q, rc.AuthorTeam)
+	if err != nil {
+		return ReviewerSlot{}, err
+	}
+	ruleReason := ""
+	if minSeniority != "" {
+		levels := loadSeniority(q, rc.CurrentReviewers)
+		var others []string
+		for _, userID := range rc.CurrentReviewers {
+			if userID != rc.OldUserID {
+				others = append(others, userID)
+			}
+		}
+		if len(atLeastSeniority([]string{rc.OldUserID}, levels, minSeniority)) > 0 && len(atLeastSeniority(others, levels, minSeniority)) == 0 {
+			tiersFor = seniorTiers(q, tiersFor, minSeniority)
+			ruleReason = seniorityRuleReason(minSeniority)
+		}
+	}
+
+	// Get active team members from old reviewer's team (excluding author and current reviewers)
+	// who still have room for another open review
+	exclude := append(append([]string{}, rc.CurrentReviewers...), rc.AuthorID)
+	candidates, atCapacity, err := splitByCapacity(q, getActiveTeamMembersExcluding(q, rc.OldReviewerTeam, rc.AuthorID, exclude))
+	if err != nil {
+		return ReviewerSlot{}, err
+	}
+
+	if tiers := tiersFor(candidates); countCandidates(tiers) > 0 {
+		// Randomly select a new reviewer using crypto/rand for security, preferring those inside working hours
+		slot, err := pickFromTiers(tiers)
+		if err != nil {
+			return ReviewerSlot{}, fmt.Errorf("failed to select reviewer: %w", err)
+		}
+		return slot, nil
+	}
+
+	// Borrow a reviewer from the team's fallback teams
+	fallbackSlots, fallbackAtCapacity, err := fillFromFallbackTeams(q, rc.OldReviewerTeam, rc.AuthorID, exclude, 1, tiersFor)
+	if err != nil {
+		return ReviewerSlot{}, err
+	}
+	if len(fallbackSlots) > 0 {
+		return fallbackSlots[0], nil
+	}
+
+	reason := ""
+	if ruleReason != "" {
+		reason = ruleReason
+	} else if len(atCapacity) > 0 || len(fallbackAtCapacity) > 0 {
+		reason = reasonAtCapacity
+	}
+	return ReviewerSlot{}, &apiError{http.StatusConflict, "NO_CANDIDATE", "no active replacement candidate in team", reason}
+}
+
+// validateChosenReviewer checks an explicitly requested replacement against the same
+// absence and never_pair rules as an explicit add. Caps and working hours are left to
+// the caller's judgement.
+func validateChosenReviewer(q dbExecutor, userID string, rc replacementContext) error {
+	teamName, err := checkNewReviewer(q, userID, rc.AuthorID, rc.CurrentReviewers)
+	if err != nil {
+		return err
+	}
+	if err := checkAddedReviewerRules(q, userID, rc.AuthorID); err != nil {
+		return err
+	}
+	if teamName != rc.OldReviewerTeam {
+		return &apiError{http.StatusConflict, "WRONG_TEAM", "new reviewer is not on the old reviewer's team", ""}
+	}
+	return nil
+}
+
+// checkNewReviewer checks that userID exists, is active and may join a PR by authorID
+// reviewed by currentReviewers, and returns the user's team
+func checkNewReviewer(q dbExecutor, userID, authorID string, currentReviewers []string) (string, error) {
+	var teamName string
+	var isActive bool
+	err := q.QueryRow("SELECT team_name, is_active FROM users WHERE user_id = $1", userID).Scan(&teamName, &isActive)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", &apiError{http.StatusNotFound, "NOT_FOUND", "new reviewer not found", ""}
+		}
+		return "", err
+	}
+
+	if userID == authorID {
+		return "", &apiError{http.StatusConflict, "REVIEWER_IS_AUTHOR", "new reviewer is the PR author", ""}
+	}
+	for _, reviewerID := range currentReviewers {
+		if reviewerID == userID {
+			return "", &apiError{http.StatusConflict, "ALREADY_ASSIGNED", "new reviewer is already assigned to this PR", ""}
+		}
+	}
+	if !isActive {
+		return "", &apiError{http.StatusConflict, "REVIEWER_INACTIVE", "new reviewer is not active", ""}
+	}
+	return teamName, nil
+}
+
+// ReviewHandoverReport is the outcome of handing over all OPEN reviews of one user
+type ReviewHandoverReport struct {
+	Reassigned []Reassignment       `json:"reassigned"`
+	Failed     []FailedReassignment `json:"failed"`
+}
+
+// FailedReassignment is an OPEN review that stayed with its reviewer, with the error
+// code and message /pullRequest/reassign would have returned
+type FailedReassignment struct {
+	PRID    string `json:"pr_id"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// reassignOpenReviews reassigns every OPEN review of userID one by one within q through
+// the same flow as /pullRequest/reassign. Reviews without a replacement stay assigned
+// and are reported as failed; any other error aborts the handover.
+func reassignOpenReviews(q dbExecutor, userID string) (ReviewHandoverReport, error) {
+	report := ReviewHandoverReport{Reassigned: []Reassignment{}, Failed: []FailedReassignment{}}
+	prIDs, err := openReviews(q, userID)
+	if err != nil {
+		return report, err
+	}
+	for _, prID := range prIDs {
+		newReviewerID, err := reassignReviewerTx(q, PullRequestReassignRequest{PullRequestID: prID, OldUserID: userID})
+		if err != nil {
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) {
+				return report, err
+			}
+			report.Failed = append(report.Failed, FailedReassignment{PRID: prID, Code: apiErr.Code, Message: apiErr.Message, Reason: apiErr.Reason})
+			continue
+		}
+		report.Reassigned = append(report.Reassigned, Reassignment{PRID: prID, OldReviewer: userID, NewReviewer: newReviewerID})
+	}
+	return report, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReassignToChosenReviewer(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend'), ('frontend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u4', 'Dave', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u5', 'Eve', 'backend', false)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u6', 'Frank', 'frontend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u7', 'Grace', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u8', 'Heidi', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Add feature', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1001', 'u2'), ('pr-1001', 'u3')")
+	_, _ = testDB.Exec(`INSERT INTO user_absences (user_id, starts_at, ends_at)
+		VALUES ('u7', CURRENT_TIMESTAMP - INTERVAL '1 day', CURRENT_TIMESTAMP + INTERVAL '1 day')`)
+	_, _ = testDB.Exec("INSERT INTO review_constraints (kind, author_id, reviewer_id, bidirectional) VALUES ('never_pair', 'u1', 'u8', false)")
+
+	tests := []struct {
+		newUserID string
+		code      string
+	}{
+		{"u9", "NOT_FOUND"},
+		{"u1", "REVIEWER_IS_AUTHOR"},
+		{"u3", "ALREADY_ASSIGNED"},
+		{"u5", "REVIEWER_INACTIVE"},
+		{"u6", "WRONG_TEAM"},
+		{"u7", "REVIEWER_ABSENT"},
+		{"u8", "NEVER_PAIR"},
+	}
+	for _, tt := range tests {
+		_, _, err := reassignReviewer(PullRequestReassignRequest{PullRequestID: "pr-1001", OldUserID: "u2", NewUserID: tt.newUserID})
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) || apiErr.Code != tt.code {
+			t.Errorf("new_user_id %s: expected %s, got %v", tt.newUserID, tt.code, err)
+		}
+	}
+
+	pr, replacedBy, err := reassignReviewer(PullRequestReassignRequest{PullRequestID: "pr-1001", OldUserID: "u2", NewUserID: "u4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacedBy != "u4" {
+		t.Errorf("Expected u4 to replace u2, got %s", replacedBy)
+	}
+	for _, slot := range pr.ReviewerSlots {
+		if slot.UserID == "u4" && slot.Reason != reasonChosenExplicitly {
+			t.Errorf("Expected reason %q, got %q", reasonChosenExplicitly, slot.Reason)
+		}
+	}
+}
+
+func TestDeactivateUserReassignsReviews(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, reassign_on_deactivate) VALUES ('backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Add feature', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1002', 'Fix bug', 'u3', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1001', 'u2'), ('pr-1002', 'u2'), ('pr-1002', 'u1')")
+
+	deactivate := func(body map[string]interface{}) map[string]json.RawMessage {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		usersSetIsActiveHandler(w, httptest.NewRequest(http.MethodPost, "/users/setIsActive", bytes.NewReader(data)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response map[string]json.RawMessage
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	// The request flag overrides the team setting
+	if response := deactivate(map[string]interface{}{"user_id": "u2", "is_active": false, "reassign_reviews": false}); response["reassignment"] != nil {
+		t.Errorf("Expected no reassignment, got %s", response["reassignment"])
+	}
+
+	response := deactivate(map[string]interface{}{"user_id": "u2", "is_active": false})
+	var report ReviewHandoverReport
+	_ = json.Unmarshal(response["reassignment"], &report)
+
+	// pr-1001 goes to u3; on pr-1002 the only other member is already a reviewer
+	if len(report.Reassigned) != 1 || report.Reassigned[0].PRID != "pr-1001" || report.Reassigned[0].NewReviewer != "u3" {
+		t.Errorf("Expected pr-1001 to move to u3, got %+v", report.Reassigned)
+	}
+	if len(report.Failed) != 1 || report.Failed[0].PRID != "pr-1002" || report.Failed[0].Code != "NO_CANDIDATE" {
+		t.Errorf("Expected pr-1002 to fail with NO_CANDIDATE, got %+v", report.Failed)
+	}
+}
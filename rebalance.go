@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// reasonRebalanced is recorded for reviewers who took over a review to even out the load
+const reasonRebalanced = "rebalanced from a more loaded team member"
+
+// planRebalance moves reviews from the most loaded candidates to the least loaded
+// receivers until no move narrows the gap, or maxMoves is reached when positive.
+// receivers limits who may take reviews, every candidate when nil. A review only moves
+// to someone who is not its author, not already reviewing the PR, below their cap and
+// not barred by paired. reviews are the OPEN reviews held by the candidates and
+// reviewers the current reviewers of every PR; both are updated with the plan.
+func planRebalance(reviews []reviewToReassign, reviewers map[string][]string, candidates []reassignmentCandidate, receivers map[string]bool, paired func(authorID, reviewerID string) bool, maxMoves int) []Reassignment {
+	loads := make([]reassignmentCandidate, len(candidates))
+	copy(loads, candidates)
+	held := map[string][]int{}
+	for i, review := range reviews {
+		held[review.UserID] = append(held[review.UserID], i)
+	}
+
+	moves := []Reassignment{}
+	for maxMoves <= 0 || len(moves) < maxMoves {
+		donor, receiver, index, ok := nextRebalanceMove(loads, held, reviews, reviewers, receivers, paired)
+		if !ok {
+			break
+		}
+
+		review := &reviews[index]
+		moves = append(moves, Reassignment{PRID: review.PRID, OldReviewer: review.UserID, NewReviewer: loads[receiver].UserID})
+
+		current := reviewers[review.PRID]
+		updated := make([]string, 0, len(current))
+		for _, userID := range current {
+			if userID != review.UserID {
+				updated = append(updated, userID)
+			}
+		}
+		reviewers[review.PRID] = append(updated, loads[receiver].UserID)
+
+		donorHeld := held[review.UserID]
+		for i, heldIndex := range donorHeld {
+			if heldIndex == index {
+				held[review.UserID] = append(donorHeld[:i:i], donorHeld[i+1:]...)
+				break
+			}
+		}
+		// A review moves at most once so the moves can be applied in one statement
+		review.UserID = loads[receiver].UserID
+		loads[donor].Load--
+		loads[receiver].Load++
+	}
+	return moves
+}
+
+// nextRebalanceMove finds the move between the most loaded donor and the least loaded
+// receiver that narrows their gap, returning their positions in loads and the review's
+// position in reviews
+func nextRebalanceMove(loads []reassignmentCandidate, held map[string][]int, reviews []reviewToReassign, reviewers map[string][]string, receivers map[string]bool, paired func(authorID, reviewerID string) bool) (donor, receiver, index int, ok bool) {
+	order := make([]int, len(loads))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return loads[order[a]].Load > loads[order[b]].Load })
+
+	for _, d := range order {
+		if len(held[loads[d].UserID]) == 0 {
+			continue
+		}
+		for k := len(order) - 1; k >= 0; k-- {
+			r := order[k]
+			candidate := loads[r]
+			if loads[d].Load-candidate.Load <= 1 {
+				break
+			}
+			if (receivers != nil && !receivers[candidate.UserID]) || (candidate.Cap >= 0 && candidate.Load >= candidate.Cap) {
+				continue
+			}
+			for _, i := range held[loads[d].UserID] {
+				review := reviews[i]
+				if review.AuthorID == candidate.UserID || containsString(reviewers[review.PRID], candidate.UserID) || paired(review.AuthorID, candidate.UserID) {
+					continue
+				}
+				return d, r, i, true
+			}
+		}
+	}
+	return 0, 0, 0, false
+}
+
+// rebalanceTeam plans and applies a rebalance of the OPEN reviews held by the active,
+// present members of teamName. receivers limits who may take reviews, everyone when nil.
+// It also returns the members' open review loads before the moves.
+func rebalanceTeam(tx dbExecutor, teamName string, receivers map[string]bool, maxMoves int) ([]Reassignment, []reassignmentCandidate, error) {
+	candidates, err := loadReassignmentCandidates(tx, teamName)
+	if err != nil {
+		return nil, nil, err
+	}
+	userIDs := make([]string, len(candidates))
+	for i, c := range candidates {
+		userIDs[i] = c.UserID
+	}
+	reviews, reviewers, err := loadReviewsToReassign(tx, userIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	paired, err := loadNeverPairs(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authors := map[string]string{}
+	for _, review := range reviews {
+		authors[review.PRID] = review.AuthorID
+	}
+
+	moves := planRebalance(reviews, reviewers, candidates, receivers, paired, maxMoves)
+	if err := applyReassignments(tx, moves, authors, reasonRebalanced); err != nil {
+		return nil, nil, err
+	}
+	return moves, candidates, nil
+}
+
+// MemberLoad is a member's number of OPEN reviews before and after a rebalance
+type MemberLoad struct {
+	UserID string `json:"user_id"`
+	Before int    `json:"before"`
+	After  int    `json:"after"`
+}
+
+// memberLoads applies moves to the loads of candidates
+func memberLoads(candidates []reassignmentCandidate, moves []Reassignment) []MemberLoad {
+	delta := map[string]int{}
+	for _, move := range moves {
+		delta[move.OldReviewer]--
+		delta[move.NewReviewer]++
+	}
+	loads := make([]MemberLoad, len(candidates))
+	for i, c := range candidates {
+		loads[i] = MemberLoad{UserID: c.UserID, Before: c.Load, After: c.Load + delta[c.UserID]}
+	}
+	return loads
+}
+
+// teamRebalanceHandler evens out the OPEN reviews of a team's active members by moving
+// reviews from the most to the least loaded. dry_run reports the moves without making them.
+func teamRebalanceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TeamName string `json:"team_name"`
+		// MaxMoves caps the number of moved reviews, unlimited when 0
+		MaxMoves int  `json:"max_moves"`
+		DryRun   bool `json:"dry_run"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.MaxMoves < 0 {
+		http.Error(w, "max_moves must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := teamExists(req.TeamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "team not found")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	moves, candidates, err := rebalanceTeam(tx, req.TeamName, nil, req.MaxMoves)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Leave a dry run to the deferred rollback
+	if !req.DryRun {
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"team_name": req.TeamName,
+		"moves":     moves,
+		"loads":     memberLoads(candidates, moves),
+		"dry_run":   req.DryRun,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
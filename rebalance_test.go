@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPlanRebalanceOntoReceivers(t *testing.T) {
+	var reviews []reviewToReassign
+	reviewers := map[string][]string{}
+	for i := 0; i < 6; i++ {
+		prID := fmt.Sprintf("pr-%d", i)
+		reviews = append(reviews, reviewToReassign{PRID: prID, AuthorID: "author", UserID: "u1"})
+		reviewers[prID] = []string{"u1"}
+	}
+	// pr-0 is already reviewed by u3 as well
+	reviewers["pr-0"] = append(reviewers["pr-0"], "u3")
+	reviews = append(reviews, reviewToReassign{PRID: "pr-0", AuthorID: "author", UserID: "u3"})
+	candidates := []reassignmentCandidate{{UserID: "u1", Load: 6, Cap: -1}, {UserID: "u2", Load: 2, Cap: -1}, {UserID: "u3", Load: 1, Cap: -1}}
+
+	moves := planRebalance(reviews, reviewers, candidates, map[string]bool{"u3": true}, noPairs, 0)
+
+	// u3 takes reviews from u1 until the gap closes: 6/1 -> 4/3
+	if len(moves) != 2 {
+		t.Fatalf("Expected 2 moves, got %+v", moves)
+	}
+	for _, move := range moves {
+		if move.OldReviewer != "u1" || move.NewReviewer != "u3" || move.PRID == "pr-0" {
+			t.Errorf("Unexpected move %+v", move)
+		}
+	}
+}
+
+func TestPlanRebalanceStopsAtMaxMoves(t *testing.T) {
+	reviews := []reviewToReassign{{PRID: "pr-1", AuthorID: "u3", UserID: "u1"}, {PRID: "pr-2", AuthorID: "u4", UserID: "u1"}, {PRID: "pr-3", AuthorID: "u4", UserID: "u1"}}
+	reviewers := map[string][]string{"pr-1": {"u1"}, "pr-2": {"u1"}, "pr-3": {"u1"}}
+	candidates := []reassignmentCandidate{{UserID: "u1", Load: 3, Cap: -1}, {UserID: "u3", Cap: -1}}
+
+	// u3 cannot review its own pr-1
+	moves := planRebalance(reviews, reviewers, candidates, nil, noPairs, 1)
+	if len(moves) != 1 || moves[0].PRID != "pr-2" {
+		t.Errorf("Expected a single move of pr-2, got %+v", moves)
+	}
+}
+
+func TestTeamActivateWithRebalance(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', false)")
+	for i := 0; i < 4; i++ {
+		prID := fmt.Sprintf("pr-%d", i)
+		_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ($1, $1, 'u1', 'OPEN')", prID)
+		_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ($1, 'u2')", prID)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"team_name": "backend", "rebalance": true})
+	w := httptest.NewRecorder()
+	teamActivateHandler(w, httptest.NewRequest(http.MethodPost, "/team/activate", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		ActivatedCount int            `json:"activated_count"`
+		Moves          []Reassignment `json:"moves"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	if response.ActivatedCount != 1 || len(response.Moves) != 2 {
+		t.Errorf("Expected u3 back with 2 reviews moved over, got %+v", response)
+	}
+
+	var load int
+	_ = testDB.QueryRow("SELECT COUNT(*) FROM pr_reviewers WHERE user_id = 'u3'").Scan(&load)
+	if load != 2 {
+		t.Errorf("Expected u3 to hold 2 reviews, got %d", load)
+	}
+}
+
+func TestMemberLoads(t *testing.T) {
+	candidates := []reassignmentCandidate{{UserID: "u1", Load: 5}, {UserID: "u2", Load: 1}}
+	loads := memberLoads(candidates, []Reassignment{{PRID: "pr-1", OldReviewer: "u1", NewReviewer: "u2"}})
+	if loads[0] != (MemberLoad{"u1", 5, 4}) || loads[1] != (MemberLoad{"u2", 1, 2}) {
+		t.Errorf("Unexpected loads %+v", loads)
+	}
+}
+
+func TestTeamRebalance(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	for i := 0; i < 6; i++ {
+		prID := fmt.Sprintf("pr-%d", i)
+		_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ($1, $1, 'u1', 'OPEN')", prID)
+		_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ($1, 'u2')", prID)
+	}
+
+	rebalance := func(body map[string]interface{}) []Reassignment {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		teamRebalanceHandler(w, httptest.NewRequest(http.MethodPost, "/team/rebalance", bytes.NewReader(data)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Moves []Reassignment `json:"moves"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Moves
+	}
+	load := func(userID string) int {
+		var count int
+		_ = testDB.QueryRow("SELECT COUNT(*) FROM pr_reviewers WHERE user_id = $1", userID).Scan(&count)
+		return count
+	}
+
+	// u1 authored every PR, so only u3 can take reviews: 6/0 -> 3/3
+	if moves := rebalance(map[string]interface{}{"team_name": "backend", "dry_run": true}); len(moves) != 3 || load("u2") != 6 {
+		t.Errorf("Expected a dry run planning 3 moves and changing nothing, got %+v", moves)
+	}
+	if moves := rebalance(map[string]interface{}{"team_name": "backend", "max_moves": 2}); len(moves) != 2 || load("u3") != 2 {
+		t.Errorf("Expected 2 moves to u3, got %+v", moves)
+	}
+}
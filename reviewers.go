@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// reasonAddedManually is recorded for a reviewer named in /pullRequest/reviewers/add
+const reasonAddedManually = "added manually"
+
+// PullRequestReviewerRequest is the body of /pullRequest/reviewers/add and /remove.
+// An add without user_id selects the reviewer the same way as on create.
+type PullRequestReviewerRequest struct {
+	PullRequestID string `json:"pull_request_id"`
+	UserID        string `json:"user_id,omitempty"`
+}
+
+// openPullRequestAuthor locks an OPEN PR and returns its author, the author's team and
+// its required tags, failing with NOT_FOUND, PR_MERGED or PR_CLOSED otherwise
+func openPullRequestAuthor(q dbExecutor, prID string) (authorID, authorTeam string, requiredTags []string, err error) {
+	var status string
+	err = q.QueryRow(`
+		SELECT pr.status, pr.author_id, u.team_name, pr.required_tags
+		FROM pull_requests pr
+		JOIN users u ON u.user_id = pr.author_id
+		WHERE pr.pull_request_id = $1
+		FOR UPDATE OF pr
+	`, prID).Scan(&status, &authorID, &authorTeam, pq.Array(&requiredTags))
+	if err == sql.ErrNoRows {
+		return "", "", nil, &apiError{http.StatusNotFound, "NOT_FOUND", "PR not found", ""}
+	}
+	if err != nil {
+		return "", "", nil, err
+	}
+	if status == "MERGED" {
+		return "", "", nil, &apiError{http.StatusConflict, "PR_MERGED", "cannot change reviewers on merged PR", ""}
+	}
+	if status == "CLOSED" {
+		return "", "", nil, &apiError{http.StatusConflict, "PR_CLOSED", "cannot change reviewers on closed PR", ""}
+	}
+	return authorID, authorTeam, requiredTags, nil
+}
+
+// addReviewer adds req.UserID, or a reviewer selected from the author's team and its
+// fallback teams, to an OPEN PR. Reviewers at their open review cap are refused.
+func addReviewer(req PullRequestReviewerRequest) (PullRequest, ReviewerSlot, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return PullRequest{}, ReviewerSlot{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	// The PR row lock makes concurrent adds see each other's reviewers
+	authorID, authorTeam, requiredTags, err := openPullRequestAuthor(tx, req.PullRequestID)
+	if err != nil {
+		return PullRequest{}, ReviewerSlot{}, err
+	}
+	currentReviewers := getCurrentReviewers(tx, req.PullRequestID)
+
+	var slot ReviewerSlot
+	if req.UserID != "" {
+		if _, err := checkNewReviewer(tx, req.UserID, authorID, currentReviewers); err != nil {
+			return PullRequest{}, ReviewerSlot{}, err
+		}
+		if err := checkAddedReviewerRules(tx, req.UserID, authorID); err != nil {
+			return PullRequest{}, ReviewerSlot{}, err
+		}
+		atCapacity, err := lockAtCapacity(tx, []string{req.UserID})
+		if err != nil {
+			return PullRequest{}, ReviewerSlot{}, err
+		}
+		if len(atCapacity) > 0 {
+			return PullRequest{}, ReviewerSlot{}, &apiError{http.StatusConflict, "AT_CAPACITY", "reviewer has reached the open review cap", reasonAtCapacity}
+		}
+		slot = ReviewerSlot{UserID: req.UserID, Reason: reasonAddedManually}
+	} else {
+		tiersFor := func(candidates []string) []candidateTier {
+			return rankByTags(tx, workingHoursTiers(tx, candidates), requiredTags)
+		}
+		exclude := append(append([]string{}, currentReviewers...), authorID)
+		candidates, atCapacity, err := splitByCapacity(tx, getActiveTeamMembersExcluding(tx, authorTeam, authorID, exclude))
+		if err != nil {
+			return PullRequest{}, ReviewerSlot{}, err
+		}
+		slots, fallbackAtCapacity, err := fillFromTeamAndFallbacks(tx, authorTeam, authorID, candidates, exclude, 1, tiersFor)
+		if err != nil {
+			return PullRequest{}, ReviewerSlot{}, err
+		}
+		if len(slots) == 0 {
+			reason := ""
+			if len(atCapacity) > 0 || len(fallbackAtCapacity) > 0 {
+				reason = reasonAtCapacity
+			}
+			return PullRequest{}, ReviewerSlot{}, &apiError{http.StatusConflict, "NO_CANDIDATE", "no active candidate to add", reason}
+		}
+		slot = slots[0]
+	}
+
+	_, err = tx.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id, assignment_reason, fallback_team) VALUES ($1, $2, $3, NULLIF($4, ''))",
+		req.PullRequestID, slot.UserID, slot.Reason, slot.FallbackTeam)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return PullRequest{}, ReviewerSlot{}, &apiError{http.StatusConflict, "ALREADY_ASSIGNED", "new reviewer is already assigned to this PR", ""}
+	}
+	if err != nil {
+		return PullRequest{}, ReviewerSlot{}, err
+	}
+
+	err = recordEvent(tx, EventReviewerAssigned, []string{slot.UserID}, EventPayload{
+		PullRequestID: req.PullRequestID,
+		AuthorID:      authorID,
+		UserID:        slot.UserID,
+	})
+	if err != nil {
+		return PullRequest{}, ReviewerSlot{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PullRequest{}, ReviewerSlot{}, err
+	}
+
+	return getPullRequest(req.PullRequestID), slot, nil
+}
+
+// checkAddedReviewerRules refuses an explicitly named reviewer who is absent or may
+// not review authorID's PRs under a never_pair constraint
+func checkAddedReviewerRules(q dbExecutor, userID, authorID string) error {
+	var absent, paired bool
+	err := q.QueryRow(`
+		SELECT NOT (`+notAbsentCondition+`), NOT (`+notPairedCondition("$2")+`)
+		FROM users
+		WHERE user_id = $1
+	`, userID, authorID).Scan(&absent, &paired)
+	if err != nil {
+		return err
+	}
+	if absent {
+		return &apiError{http.StatusConflict, "REVIEWER_ABSENT", "reviewer is absent", ""}
+	}
+	if paired {
+		return &apiError{http.StatusConflict, "NEVER_PAIR", "reviewer may not review this author's PRs", ""}
+	}
+	return nil
+}
+
+// removeReviewer drops req.UserID from an OPEN PR without a replacement
+func removeReviewer(req PullRequestReviewerRequest) (PullRequest, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return PullRequest{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	authorID, _, _, err := openPullRequestAuthor(tx, req.PullRequestID)
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	if err := archiveReviewers(tx, []string{req.PullRequestID}, []string{req.UserID}); err != nil {
+		return PullRequest{}, err
+	}
+	result, err := tx.Exec("DELETE FROM pr_reviewers WHERE pull_request_id = $1 AND user_id = $2", req.PullRequestID, req.UserID)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return PullRequest{}, &apiError{http.StatusConflict, "NOT_ASSIGNED", "reviewer is not assigned to this PR", ""}
+	}
+
+	err = recordEvent(tx, EventReviewerUnassigned, []string{req.UserID}, EventPayload{
+		PullRequestID: req.PullRequestID,
+		AuthorID:      authorID,
+		UserID:        req.UserID,
+	})
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PullRequest{}, err
+	}
+
+	return getPullRequest(req.PullRequestID), nil
+}
+
+func pullRequestReviewersAddHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PullRequestReviewerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.PullRequestID == "" {
+		http.Error(w, "pull_request_id is required", http.StatusBadRequest)
+		return
+	}
+
+	pr, slot, err := addReviewer(req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"pr":    pr,
+		"added": slot.UserID,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func pullRequestReviewersRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PullRequestReviewerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.PullRequestID == "" || req.UserID == "" {
+		http.Error(w, "pull_request_id and user_id are required", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := removeReviewer(req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"pr":      pr,
+		"removed": req.UserID,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddAndRemoveReviewers(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, max_open_reviews) VALUES ('u4', 'Dave', 'backend', true, 0)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Add feature', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1001', 'u2')")
+
+	var apiErr *apiError
+	_, _, err := addReviewer(PullRequestReviewerRequest{PullRequestID: "pr-1001", UserID: "u4"})
+	if !errors.As(err, &apiErr) || apiErr.Code != "AT_CAPACITY" {
+		t.Errorf("Expected AT_CAPACITY, got %v", err)
+	}
+
+	// Without user_id the only free member is selected
+	pr, slot, err := addReviewer(PullRequestReviewerRequest{PullRequestID: "pr-1001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot.UserID != "u3" || len(pr.AssignedReviewers) != 2 {
+		t.Errorf("Expected u3 to be added, got %s and %v", slot.UserID, pr.AssignedReviewers)
+	}
+
+	pr, err = removeReviewer(PullRequestReviewerRequest{PullRequestID: "pr-1001", UserID: "u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u3" {
+		t.Errorf("Expected only u3 to remain, got %v", pr.AssignedReviewers)
+	}
+
+	var events int
+	_ = testDB.QueryRow("SELECT COUNT(*) FROM events WHERE event_type IN ('reviewer.assigned', 'reviewer.unassigned')").Scan(&events)
+	if events != 2 {
+		t.Errorf("Expected both changes in the event log, got %d events", events)
+	}
+
+	_, _ = testDB.Exec("UPDATE pull_requests SET status = 'MERGED' WHERE pull_request_id = 'pr-1001'")
+	_, err = removeReviewer(PullRequestReviewerRequest{PullRequestID: "pr-1001", UserID: "u3"})
+	if !errors.As(err, &apiErr) || apiErr.Code != "PR_MERGED" {
+		t.Errorf("Expected PR_MERGED, got %v", err)
+	}
+}
+
+func TestAddReviewerChecksAbsenceAndNeverPair(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Add feature', 'u1', 'OPEN')")
+	_, _ = testDB.Exec(`INSERT INTO user_absences (user_id, starts_at, ends_at)
+		VALUES ('u2', CURRENT_TIMESTAMP - INTERVAL '1 day', CURRENT_TIMESTAMP + INTERVAL '1 day')`)
+	_, _ = testDB.Exec("INSERT INTO review_constraints (kind, author_id, reviewer_id, bidirectional) VALUES ('never_pair', 'u1', 'u3', false)")
+
+	var apiErr *apiError
+	_, _, err := addReviewer(PullRequestReviewerRequest{PullRequestID: "pr-1001", UserID: "u2"})
+	if !errors.As(err, &apiErr) || apiErr.Code != "REVIEWER_ABSENT" {
+		t.Errorf("Expected REVIEWER_ABSENT, got %v", err)
+	}
+	_, _, err = addReviewer(PullRequestReviewerRequest{PullRequestID: "pr-1001", UserID: "u3"})
+	if !errors.As(err, &apiErr) || apiErr.Code != "NEVER_PAIR" {
+		t.Errorf("Expected NEVER_PAIR, got %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	// Embedded so time zones resolve in the alpine image, which ships without tzdata
+	_ "time/tzdata"
+
+	"github.com/lib/pq"
+)
+
+// Assignment reasons recorded in pr_reviewers.assignment_reason
+const (
+	reasonWorkingHours = "available: inside working hours"
+	reasonOffHours     = "fallback: nobody inside working hours was available"
+)
+
+// ReviewerSlot is an assigned reviewer together with why they were picked
+type ReviewerSlot struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason,omitempty"`
+	// FallbackTeam is set when the reviewer was borrowed from one of the team's fallback teams
+	FallbackTeam string `json:"fallback_team,omitempty"`
+}
+
+// candidateTier is a group of equally preferred candidates. Selection walks tiers in
+// order and only picks randomly within a tier.
+type candidateTier struct {
+	UserIDs []string
+	Reason  string
+}
+
+// workSchedule is a user's working hours in their own time zone. Empty hours mean
+// the user did not configure any and is treated as always working.
+type workSchedule struct {
+	TimeZone  string
+	WorkStart string
+	WorkEnd   string
+}
+
+// fillSlots picks up to count reviewers, exhausting each tier before moving to the next
+func fillSlots(tiers []candidateTier, count int) []ReviewerSlot {
+	slots := []ReviewerSlot{}
+	for _, tier := range tiers {
+		remaining := count - len(slots)
+		if remaining <= 0 {
+			break
+		}
+		for _, userID := range assignReviewers(tier.UserIDs, remaining) {
+			slots = append(slots, ReviewerSlot{UserID: userID, Reason: tier.Reason})
+		}
+	}
+	return slots
+}
+
+// pickFromTiers picks one random candidate from the most preferred non-empty tier
+func pickFromTiers(tiers []candidateTier) (ReviewerSlot, error) {
+	for _, tier := range tiers {
+		if len(tier.UserIDs) == 0 {
+			continue
+		}
+		userID, err := selectRandomCandidate(tier.UserIDs)
+		if err != nil {
+			return ReviewerSlot{}, err
+		}
+		return ReviewerSlot{UserID: userID, Reason: tier.Reason}, nil
+	}
+	return ReviewerSlot{}, fmt.Errorf("no candidates available")
+}
+
+// workingHoursTiers puts candidates who are inside their working hours right now
+// ahead of everyone else
+func workingHoursTiers(q dbExecutor, candidates []string) []candidateTier {
+	schedules := loadSchedules(q, candidates)
+	now := time.Now()
+
+	var working, offHours []string
+	for _, userID := range candidates {
+		if withinWorkingHours(now, schedules[userID]) {
+			working = append(working, userID)
+		} else {
+			offHours = append(offHours, userID)
+		}
+	}
+
+	return []candidateTier{
+		{UserIDs: working, Reason: reasonWorkingHours},
+		{UserIDs: offHours, Reason: reasonOffHours},
+	}
+}
+
+// labelTiers prepends label to the reason of every tier
+func labelTiers(tiers []candidateTier, label string) []candidateTier {
+	labeled := make([]candidateTier, len(tiers))
+	for i, tier := range tiers {
+		labeled[i] = candidateTier{UserIDs: tier.UserIDs, Reason: label + "; " + tier.Reason}
+	}
+	return labeled
+}
+
+// countCandidates is the number of candidates across all tiers
+func countCandidates(tiers []candidateTier) int {
+	count := 0
+	for _, tier := range tiers {
+		count += len(tier.UserIDs)
+	}
+	return count
+}
+
+// preferTiers moves the preferred candidates of every tier into tiers of their own ahead
+// of the rest, so the preference outranks working hours but not the other way round.
+// label is prepended to the reasons of the preferred tiers.
+func preferTiers(tiers []candidateTier, preferred map[string]bool, label string) []candidateTier {
+	var first, rest []candidateTier
+	for _, tier := range tiers {
+		var in, out []string
+		for _, userID := range tier.UserIDs {
+			if preferred[userID] {
+				in = append(in, userID)
+			} else {
+				out = append(out, userID)
+			}
+		}
+		first = append(first, candidateTier{UserIDs: in, Reason: label + "; " + tier.Reason})
+		rest = append(rest, candidateTier{UserIDs: out, Reason: tier.Reason})
+	}
+	return append(first, rest...)
+}
+
+func loadSchedules(q dbExecutor, userIDs []string) map[string]workSchedule {
+	schedules := map[string]workSchedule{}
+	if len(userIDs) == 0 {
+		return schedules
+	}
+
+	rows, err := q.Query(`
+		SELECT user_id, time_zone, COALESCE(to_char(work_start, 'HH24:MI'), ''), COALESCE(to_char(work_end, 'HH24:MI'), '')
+		FROM users WHERE user_id = ANY($1)
+	`, pq.Array(userIDs))
+	if err != nil {
+		log.Printf("Error loading working hours: %v", err)
+		return schedules
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var userID string
+		var s workSchedule
+		if err := rows.Scan(&userID, &s.TimeZone, &s.WorkStart, &s.WorkEnd); err != nil {
+			continue
+		}
+		schedules[userID] = s
+	}
+	return schedules
+}
+
+// withinWorkingHours reports whether now falls inside the schedule. Shifts that end
+// before they start wrap around midnight.
+func withinWorkingHours(now time.Time, s workSchedule) bool {
+	if s.WorkStart == "" || s.WorkEnd == "" {
+		return true
+	}
+
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	start, err1 := time.Parse("15:04", s.WorkStart)
+	end, err2 := time.Parse("15:04", s.WorkEnd)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute
+	}
+	return minute >= startMinute || minute < endMinute
+}
+
+// usersSetWorkingHoursHandler sets a user's time zone and working hours ("HH:MM").
+// Empty work_start and work_end clear the hours.
+func usersSetWorkingHoursHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID    string `json:"user_id"`
+		TimeZone  string `json:"time_zone"`
+		WorkStart string `json:"work_start"`
+		WorkEnd   string `json:"work_end"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.TimeZone == "" {
+		req.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.TimeZone); err != nil {
+		http.Error(w, "unknown time_zone: "+req.TimeZone, http.StatusBadRequest)
+		return
+	}
+	if (req.WorkStart == "") != (req.WorkEnd == "") {
+		http.Error(w, "work_start and work_end must be set together", http.StatusBadRequest)
+		return
+	}
+
+	var workStart, workEnd interface{}
+	if req.WorkStart != "" {
+		if _, err := time.Parse("15:04", req.WorkStart); err != nil {
+			http.Error(w, "work_start must be HH:MM", http.StatusBadRequest)
+			return
+		}
+		if _, err := time.Parse("15:04", req.WorkEnd); err != nil {
+			http.Error(w, "work_end must be HH:MM", http.StatusBadRequest)
+			return
+		}
+		workStart, workEnd = req.WorkStart, req.WorkEnd
+	}
+
+	result, err := db.Exec("UPDATE users SET time_zone = $1, work_start = $2, work_end = $3 WHERE user_id = $4",
+		req.TimeZone, workStart, workEnd, req.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "user not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":    req.UserID,
+		"time_zone":  req.TimeZone,
+		"work_start": req.WorkStart,
+		"work_end":   req.WorkEnd,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithinWorkingHours(t *testing.T) {
+	// 2025-11-20 16:30 UTC is 19:30 in Moscow and 08:30 in Los Angeles
+	now := time.Date(2025, 11, 20, 16, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		schedule workSchedule
+		want     bool
+	}{
+		{"no hours configured", workSchedule{TimeZone: "UTC"}, true},
+		{"inside UTC day", workSchedule{TimeZone: "UTC", WorkStart: "09:00", WorkEnd: "18:00"}, true},
+		{"Moscow day has ended", workSchedule{TimeZone: "Europe/Moscow", WorkStart: "09:00", WorkEnd: "18:00"}, false},
+		{"Los Angeles day not started", workSchedule{TimeZone: "America/Los_Angeles", WorkStart: "09:00", WorkEnd: "18:00"}, false},
+		{"overnight shift", workSchedule{TimeZone: "Europe/Moscow", WorkStart: "19:00", WorkEnd: "03:00"}, true},
+	}
+
+	for _, tc := range cases {
+		if got := withinWorkingHours(now, tc.schedule); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestFillSlotsPrefersEarlierTiers(t *testing.T) {
+	tiers := []candidateTier{
+		{UserIDs: []string{"u2"}, Reason: "first"},
+		{UserIDs: []string{"u3", "u4"}, Reason: "second"},
+	}
+
+	slots := fillSlots(tiers, 2)
+	if len(slots) != 2 {
+		t.Fatalf("Expected 2 slots, got %d", len(slots))
+	}
+	if slots[0].UserID != "u2" || slots[0].Reason != "first" {
+		t.Errorf("Expected u2 from first tier, got %+v", slots[0])
+	}
+	if slots[1].Reason != "second" {
+		t.Errorf("Expected second slot from second tier, got %+v", slots[1])
+	}
+
+	if slots := fillSlots(tiers, 5); len(slots) != 3 {
+		t.Errorf("Expected all 3 candidates when asking for more, got %d", len(slots))
+	}
+}
+
+func TestPickFromTiersSkipsEmptyTiers(t *testing.T) {
+	slot, err := pickFromTiers([]candidateTier{{Reason: "empty"}, {UserIDs: []string{"u3"}, Reason: "second"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot.UserID != "u3" || slot.Reason != "second" {
+		t.Errorf("Expected u3 from second tier, got %+v", slot)
+	}
+
+	if _, err := pickFromTiers([]candidateTier{{Reason: "empty"}}); err == nil {
+		t.Error("Expected error when no tier has candidates")
+	}
+}
+
+func TestCreatePrefersWorkingHours(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u4', 'Dave', 'backend', true)")
+	// u4 works a one-minute shift that is never now
+	now := time.Now().UTC()
+	start := now.Add(2 * time.Hour).Format("15:04")
+	end := now.Add(2*time.Hour + time.Minute).Format("15:04")
+	_, _ = testDB.Exec("UPDATE users SET work_start = $1, work_end = $2 WHERE user_id = 'u4'", start, end)
+
+	pr, _, err := createPullRequest(PullRequestCreateRequest{PullRequestID: "pr-1001", PullRequestName: "Add feature", AuthorID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, slot := range pr.ReviewerSlots {
+		if slot.UserID == "u4" {
+			t.Errorf("Expected off-hours u4 to be skipped while others are working, got %+v", pr.ReviewerSlots)
+		}
+		if slot.Reason != reasonWorkingHours {
+			t.Errorf("Expected reason %q, got %q", reasonWorkingHours, slot.Reason)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// seniorityLevels are the known levels, most junior first
+var seniorityLevels = []string{"junior", "middle", "senior", "lead"}
+
+// seniorityRank orders levels starting at 1; unknown or unset levels rank 0
+func seniorityRank(level string) int {
+	for i, l := range seniorityLevels {
+		if l == level {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// seniorityRuleReason is the reason recorded for the reviewer who satisfies a team's seniority rule
+func seniorityRuleReason(minSeniority string) string {
+	return "rule: at least one reviewer " + minSeniority + " or above"
+}
+
+// minReviewerSeniority returns the team's seniority rule, or "" when it has none
+func minReviewerSeniority(q dbExecutor, teamName string) (string, error) {
+	var minSeniority sql.NullString
+	err := q.QueryRow("SELECT min_reviewer_seniority FROM teams WHERE team_name = $1", teamName).Scan(&minSeniority)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return minSeniority.String, err
+}
+
+// atLeastSeniority keeps the candidates whose level is minSeniority or above
+func atLeastSeniority(candidates []string, levels map[string]string, minSeniority string) []string {
+	minRank := seniorityRank(minSeniority)
+	var senior []string
+	for _, userID := range candidates {
+		if seniorityRank(levels[userID]) >= minRank {
+			senior = append(senior, userID)
+		}
+	}
+	return senior
+}
+
+// seniorTiers restricts tiersFor to candidates satisfying the seniority rule and labels them with it
+func seniorTiers(q dbExecutor, tiersFor func([]string) []candidateTier, minSeniority string) func([]string) []candidateTier {
+	return func(candidates []string) []candidateTier {
+		senior := atLeastSeniority(candidates, loadSeniority(q, candidates), minSeniority)
+		return labelTiers(tiersFor(senior), seniorityRuleReason(minSeniority))
+	}
+}
+
+func loadSeniority(q dbExecutor, userIDs []string) map[string]string {
+	levels := map[string]string{}
+	if len(userIDs) == 0 {
+		return levels
+	}
+
+	rows, err := q.Query("SELECT user_id, seniority FROM users WHERE user_id = ANY($1) AND seniority IS NOT NULL", pq.Array(userIDs))
+	if err != nil {
+		log.Printf("Error loading seniority: %v", err)
+		return levels
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var userID, level string
+		if err := rows.Scan(&userID, &level); err != nil {
+			continue
+		}
+		levels[userID] = level
+	}
+	return levels
+}
+
+// usersSetSeniorityHandler sets a user's seniority level; an empty level clears it
+func usersSetSeniorityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID    string `json:"user_id"`
+		Seniority string `json:"seniority"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Seniority != "" && seniorityRank(req.Seniority) == 0 {
+		http.Error(w, "seniority must be one of "+strings.Join(seniorityLevels, ", "), http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("UPDATE users SET seniority = NULLIF($1, '') WHERE user_id = $2", req.Seniority, req.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "user not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":   req.UserID,
+		"seniority": req.Seniority,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
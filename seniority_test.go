@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAtLeastSeniority(t *testing.T) {
+	levels := map[string]string{"u2": "junior", "u3": "senior", "u4": "lead"}
+
+	got := atLeastSeniority([]string{"u2", "u3", "u4", "u5"}, levels, "senior")
+	if !reflect.DeepEqual(got, []string{"u3", "u4"}) {
+		t.Errorf("Expected u3 and u4, got %v", got)
+	}
+	if seniorityRank("principal") != 0 {
+		t.Error("Expected unknown level to rank 0")
+	}
+}
+
+func TestCreateSatisfiesSeniorityRule(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, min_reviewer_seniority) VALUES ('backend', 'senior')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, seniority) VALUES ('u1', 'Alice', 'backend', true, 'junior')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, seniority) VALUES ('u2', 'Bob', 'backend', true, 'junior')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, seniority) VALUES ('u3', 'Charlie', 'backend', true, 'junior')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, seniority) VALUES ('u4', 'Dave', 'backend', true, 'lead')")
+
+	pr, report, err := createPullRequest(PullRequestCreateRequest{PullRequestID: "pr-1001", PullRequestName: "Add feature", AuthorID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pr.ReviewerSlots) != 2 || pr.ReviewerSlots[0].UserID != "u4" {
+		t.Fatalf("Expected lead u4 in the first slot, got %+v", pr.ReviewerSlots)
+	}
+	if pr.ReviewerSlots[0].Reason != seniorityRuleReason("senior")+"; "+reasonWorkingHours {
+		t.Errorf("Expected the slot to name the rule, got %q", pr.ReviewerSlots[0].Reason)
+	}
+	if len(report.UnsatisfiedRules) != 0 {
+		t.Errorf("Expected the rule to be satisfied, got %v", report.UnsatisfiedRules)
+	}
+
+	// Swapping the lead for a junior would break the rule
+	_, _, err = reassignReviewer(PullRequestReassignRequest{PullRequestID: "pr-1001", OldUserID: "u4"})
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.Code != "NO_CANDIDATE" || apiErr.Reason != seniorityRuleReason("senior") {
+		t.Errorf("Expected NO_CANDIDATE for the seniority rule, got %v", err)
+	}
+}
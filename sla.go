@@ -0,0 +1,325 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of overdue items in the SLA report
+const (
+	overdueFirstReview = "first_review"
+	overdueMerge       = "merge"
+)
+
+// defaultReportWindow is how far back reports look when no from is given
+const defaultReportWindow = 30 * 24 * time.Hour
+
+// parseTimeWindow reads the optional RFC 3339 from and to query parameters. to defaults
+// to now and from to defaultReportWindow before to.
+func parseTimeWindow(query url.Values) (from, to time.Time, err error) {
+	fromParam, err := parseTimeParam(query, "from")
+	if err != nil {
+		return from, to, err
+	}
+	toParam, err := parseTimeParam(query, "to")
+	if err != nil {
+		return from, to, err
+	}
+
+	to = time.Now().UTC()
+	if toParam != nil {
+		to = *toParam
+	}
+	from = to.Add(-defaultReportWindow)
+	if fromParam != nil {
+		from = *fromParam
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// OverdueItem is an OPEN PR past one of its team's SLA targets
+type OverdueItem struct {
+	PullRequestID string `json:"pull_request_id"`
+	TeamName      string `json:"team_name"`
+	Kind          string `json:"kind"`
+	// UserID is the reviewer who has not responded, for first_review items
+	UserID       string  `json:"user_id,omitempty"`
+	DueAt        string  `json:"due_at"`
+	OverdueHours float64 `json:"overdue_hours"`
+}
+
+// ReviewerCompliance is how one reviewer kept the time to first review target for
+// reviews assigned within the report window
+type ReviewerCompliance struct {
+	UserID   string `json:"user_id"`
+	Assigned int    `json:"assigned"`
+	// Due counts the reviews that were answered or whose deadline has passed
+	Due       int `json:"due"`
+	WithinSLA int `json:"within_sla"`
+	// Compliance is WithinSLA / Due, absent while nothing is due
+	Compliance            *float64 `json:"compliance,omitempty"`
+	AvgFirstResponseHours *float64 `json:"avg_first_response_hours,omitempty"`
+}
+
+// MergeCompliance is how PRs merged within the report window kept the time to merge target
+type MergeCompliance struct {
+	Merged    int `json:"merged"`
+	WithinSLA int `json:"within_sla"`
+}
+
+// pullRequestRespondHandler records a reviewer's first response to a PR, which the
+// time to first review SLA is measured against. Later responses keep the first time.
+func pullRequestRespondHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+		UserID        string `json:"user_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.PullRequestID == "" || req.UserID == "" {
+		http.Error(w, "pull_request_id and user_id are required", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	err := db.QueryRow("SELECT status FROM pull_requests WHERE pull_request_id = $1", req.PullRequestID).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendError(w, http.StatusNotFound, "NOT_FOUND", "PR not found")
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if status == "MERGED" {
+		sendError(w, http.StatusConflict, "PR_MERGED", "cannot respond on merged PR")
+		return
+	}
+	if status == "CLOSED" {
+		sendError(w, http.StatusConflict, "PR_CLOSED", "cannot respond on closed PR")
+		return
+	}
+
+	var assignedAt, firstResponseAt time.Time
+	err = db.QueryRow(`
+		UPDATE pr_reviewers
+		SET first_response_at = COALESCE(first_response_at, CURRENT_TIMESTAMP)
+		WHERE pull_request_id = $1 AND user_id = $2
+		RETURNING assigned_at, first_response_at
+	`, req.PullRequestID, req.UserID).Scan(&assignedAt, &firstResponseAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendError(w, http.StatusConflict, "NOT_ASSIGNED", "reviewer is not assigned to this PR")
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"pull_request_id":   req.PullRequestID,
+		"user_id":           req.UserID,
+		"assigned_at":       assignedAt.Format(time.RFC3339),
+		"first_response_at": firstResponseAt.Format(time.RFC3339),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// slaReportHandler lists OPEN PRs past their team's SLA targets and reports SLA
+// compliance over the window given by from and to, optionally for team_name only.
+// Targets are those of the PR author's team.
+func slaReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamName := r.URL.Query().Get("team_name")
+	from, to, err := parseTimeWindow(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if teamName != "" {
+		exists, err := teamExists(teamName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			sendError(w, http.StatusNotFound, "NOT_FOUND", "team not found")
+			return
+		}
+	}
+
+	overdue, err := loadOverdue(teamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reviewers, err := loadReviewerCompliance(teamName, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var merge MergeCompliance
+	err = db.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE pr.merged_at <= pr.created_at + make_interval(hours => t.sla_merge_hours))
+		FROM pull_requests pr
+		JOIN users a ON a.user_id = pr.author_id
+		JOIN teams t ON t.team_name = a.team_name
+		WHERE pr.status = 'MERGED' AND t.sla_merge_hours IS NOT NULL
+			AND pr.merged_at >= $2 AND pr.merged_at < $3
+			AND ($1 = '' OR a.team_name = $1)
+	`, teamName, from, to).Scan(&merge.Merged, &merge.WithinSLA)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":      from.Format(time.RFC3339),
+		"to":        to.Format(time.RFC3339),
+		"overdue":   overdue,
+		"reviewers": reviewers,
+		"merge":     merge,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// loadOverdue returns the OPEN PRs past a time to first review or time to merge
+// target, most overdue first
+func loadOverdue(teamName string) ([]OverdueItem, error) {
+	rows, err := db.Query(`
+		SELECT * FROM (
+			SELECT r.pull_request_id, a.team_name, $2::text AS kind, r.user_id,
+				r.assigned_at + make_interval(hours => t.sla_first_review_hours) AS due_at
+			FROM pr_reviewers r
+			JOIN pull_requests pr ON pr.pull_request_id = r.pull_request_id
+			JOIN users a ON a.user_id = pr.author_id
+			JOIN teams t ON t.team_name = a.team_name
+			WHERE pr.status = 'OPEN' AND r.first_response_at IS NULL AND t.sla_first_review_hours IS NOT NULL
+			UNION ALL
+			SELECT pr.pull_request_id, a.team_name, $3::text, '',
+				pr.created_at + make_interval(hours => t.sla_merge_hours)
+			FROM pull_requests pr
+			JOIN users a ON a.user_id = pr.author_id
+			JOIN teams t ON t.team_name = a.team_name
+			WHERE pr.status = 'OPEN' AND t.sla_merge_hours IS NOT NULL
+		) items
+		WHERE due_at < CURRENT_TIMESTAMP AND ($1 = '' OR team_name = $1)
+		ORDER BY due_at, pull_request_id, user_id
+	`, teamName, overdueFirstReview, overdueMerge)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	overdue := []OverdueItem{}
+	for rows.Next() {
+		var item OverdueItem
+		var dueAt time.Time
+		if err := rows.Scan(&item.PullRequestID, &item.TeamName, &item.Kind, &item.UserID, &dueAt); err != nil {
+			return nil, err
+		}
+		item.DueAt = dueAt.Format(time.RFC3339)
+		item.OverdueHours = now.Sub(dueAt).Hours()
+		overdue = append(overdue, item)
+	}
+	return overdue, rows.Err()
+}
+
+// loadReviewerCompliance reports every reviewer's time to first review compliance
+// for reviews assigned within [from, to), including reviews since handed over or dropped
+func loadReviewerCompliance(teamName string, from, to time.Time) ([]ReviewerCompliance, error) {
+	rows, err := db.Query(`
+		SELECT r.user_id, COUNT(*),
+			COUNT(*) FILTER (WHERE r.first_response_at IS NOT NULL
+				OR r.assigned_at + make_interval(hours => t.sla_first_review_hours) < COALESCE(r.ended_at, pr.closed_at, LOCALTIMESTAMP)),
+			COUNT(*) FILTER (WHERE r.first_response_at <= r.assigned_at + make_interval(hours => t.sla_first_review_hours)),
+			AVG(EXTRACT(EPOCH FROM r.first_response_at - r.assigned_at) / 3600)
+		FROM (
+			SELECT pull_request_id, user_id, assigned_at, first_response_at, NULL::timestamp AS ended_at FROM pr_reviewers
+			UNION ALL
+			SELECT pull_request_id, user_id, assigned_at, first_response_at, ended_at FROM pr_reviewer_history
+		) r
+		JOIN pull_requests pr ON pr.pull_request_id = r.pull_request_id
+		JOIN users a ON a.user_id = pr.author_id
+		JOIN teams t ON t.team_name = a.team_name
+		WHERE t.sla_first_review_hours IS NOT NULL
+			AND r.assigned_at >= $2 AND r.assigned_at < $3
+			AND ($1 = '' OR a.team_name = $1)
+		GROUP BY r.user_id
+		ORDER BY r.user_id
+	`, teamName, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	reviewers := []ReviewerCompliance{}
+	for rows.Next() {
+		var c ReviewerCompliance
+		var avg sql.NullFloat64
+		if err := rows.Scan(&c.UserID, &c.Assigned, &c.Due, &c.WithinSLA, &avg); err != nil {
+			return nil, err
+		}
+		if c.Due > 0 {
+			compliance := float64(c.WithinSLA) / float64(c.Due)
+			c.Compliance = &compliance
+		}
+		if avg.Valid {
+			c.AvgFirstResponseHours = &avg.Float64
+		}
+		reviewers = append(reviewers, c)
+	}
+	return reviewers, rows.Err()
+}
+
+// archiveReviewers records the reviews of prIDs[i] by userIDs[i] in pr_reviewer_history
+// before they are handed over or dropped, so SLA compliance still counts the reviewer
+// who held them
+func archiveReviewers(q dbExecutor, prIDs, userIDs []string) error {
+	_, err := q.Exec(`
+		INSERT INTO pr_reviewer_history (pull_request_id, user_id, assigned_at, first_response_at)
+		SELECT r.pull_request_id, r.user_id, r.assigned_at, r.first_response_at
+		FROM pr_reviewers r
+		JOIN unnest($1::text[], $2::text[]) AS p(pull_request_id, user_id)
+			ON r.pull_request_id = p.pull_request_id AND r.user_id = p.user_id
+	`, pq.Array(prIDs), pq.Array(userIDs))
+	return err
+}
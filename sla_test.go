@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	from, to, err := parseTimeWindow(url.Values{"to": {"2025-03-31T00:00:00Z"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to.Sub(from) != defaultReportWindow {
+		t.Errorf("Expected the default window before to, got %v to %v", from, to)
+	}
+
+	from, _, err = parseTimeWindow(url.Values{"from": {"2025-03-01T00:00:00Z"}})
+	if err != nil || !from.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected from to be parsed, got %v (%v)", from, err)
+	}
+
+	if _, _, err := parseTimeWindow(url.Values{"from": {"yesterday"}}); err == nil {
+		t.Error("Expected an error for a malformed from")
+	}
+
+	if _, _, err := parseTimeWindow(url.Values{"from": {"2025-03-31T00:00:00Z"}, "to": {"2025-03-01T00:00:00Z"}}); err == nil {
+		t.Error("Expected an error for from after to")
+	}
+}
+
+func TestSLAReport(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, sla_first_review_hours, sla_merge_hours) VALUES ('backend', 4, 48)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status, created_at) VALUES ('pr-1001', 'Add feature', 'u1', 'OPEN', CURRENT_TIMESTAMP - INTERVAL '60 hours')")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status, created_at, merged_at) VALUES ('pr-1002', 'Fix bug', 'u1', 'MERGED', CURRENT_TIMESTAMP - INTERVAL '10 hours', CURRENT_TIMESTAMP)")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id, assigned_at) VALUES ('pr-1001', 'u2', CURRENT_TIMESTAMP - INTERVAL '6 hours')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id, assigned_at) VALUES ('pr-1001', 'u3', CURRENT_TIMESTAMP - INTERVAL '1 hour')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id, assigned_at, first_response_at) VALUES ('pr-1002', 'u2', CURRENT_TIMESTAMP - INTERVAL '10 hours', CURRENT_TIMESTAMP - INTERVAL '9 hours')")
+
+	respond := func(userID string) int {
+		body, _ := json.Marshal(map[string]string{"pull_request_id": "pr-1001", "user_id": userID})
+		w := httptest.NewRecorder()
+		pullRequestRespondHandler(w, httptest.NewRequest(http.MethodPost, "/pullRequest/respond", bytes.NewReader(body)))
+		return w.Code
+	}
+	if code := respond("u1"); code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a user who is not a reviewer, got %d", code)
+	}
+	if code := respond("u3"); code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	slaReportHandler(w, httptest.NewRequest(http.MethodGet, "/sla/report?team_name=backend", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var report struct {
+		Overdue   []OverdueItem        `json:"overdue"`
+		Reviewers []ReviewerCompliance `json:"reviewers"`
+		Merge     MergeCompliance      `json:"merge"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &report)
+
+	// pr-1001 is past its merge target and u2 has not responded within 4 hours
+	if len(report.Overdue) != 2 || report.Overdue[0].Kind != overdueMerge ||
+		report.Overdue[1].Kind != overdueFirstReview || report.Overdue[1].UserID != "u2" {
+		t.Errorf("Expected an overdue merge and an overdue first review by u2, got %+v", report.Overdue)
+	}
+
+	// u2 answered pr-1002 in time but not pr-1001
+	if len(report.Reviewers) != 2 || report.Reviewers[0].UserID != "u2" ||
+		report.Reviewers[0].Due != 2 || report.Reviewers[0].WithinSLA != 1 {
+		t.Errorf("Expected u2 to have kept 1 of 2 due reviews, got %+v", report.Reviewers)
+	}
+	if c := report.Reviewers[1].Compliance; c == nil || *c != 1 {
+		t.Errorf("Expected u3 to be fully compliant, got %+v", report.Reviewers[1])
+	}
+
+	if report.Merge.Merged != 1 || report.Merge.WithinSLA != 1 {
+		t.Errorf("Expected 1 merge within target, got %+v", report.Merge)
+	}
+}
+
+func TestSLAReportKeepsHandedOverReviews(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, sla_first_review_hours) VALUES ('backend', 4)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Add feature', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id, assigned_at) VALUES ('pr-1001', 'u2', CURRENT_TIMESTAMP - INTERVAL '6 hours')")
+
+	if _, _, err := reassignReviewer(PullRequestReassignRequest{PullRequestID: "pr-1001", OldUserID: "u2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reviewers, err := loadReviewerCompliance("backend", time.Now().Add(-24*time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviewers) == 0 || reviewers[0].UserID != "u2" || reviewers[0].Due != 1 || reviewers[0].WithinSLA != 0 {
+		t.Errorf("Expected u2's missed review to be kept after the handover, got %+v", reviewers)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// reviewerResetColumns restarts the review clock of a pr_reviewers row handed to a new reviewer
+const reviewerResetColumns = "assigned_at = CURRENT_TIMESTAMP, reminded_at = NULL, escalated_at = NULL, first_response_at = NULL"
+
+// staleReviewLockKey is the advisory lock that keeps the stale review scheduler to a
+// single replica at a time
+const staleReviewLockKey = 48_150_001
+
+// staleReviewBatch caps the escalations handled per run, as each one is a reassignment
+const staleReviewBatch = 50
+
+// runStaleReviewScheduler periodically reminds reviewers of reviews that have waited
+// longer than their team's reminder_after_hours and reassigns those past escalate_after_hours
+func runStaleReviewScheduler(ctx context.Context) {
+	ticker := time.NewTicker(envDuration("STALE_REVIEW_SCHEDULER_INTERVAL", 5*time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := processStaleReviews(ctx); err != nil {
+				log.Printf("Error processing stale reviews: %v", err)
+			}
+		}
+	}
+}
+
+// processStaleReviews sends due reminders and escalations. A session-level advisory
+// lock makes other replicas skip the run while one is at it. Reminders and each
+// escalation commit separately, since escalating reassigns through its own transaction.
+func processStaleReviews(ctx context.Context) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Printf("Error closing connection: %v", err)
+		}
+	}()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", staleReviewLockKey).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", staleReviewLockKey); err != nil {
+			log.Printf("Error releasing stale review lock: %v", err)
+		}
+	}()
+
+	if err := sendReviewReminders(); err != nil {
+		return err
+	}
+	return escalateStaleReviews()
+}
+
+// sendReviewReminders marks every unanswered OPEN review past its team's reminder
+// threshold as reminded and notifies the reviewer with a review.reminder event
+func sendReviewReminders() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	rows, err := tx.Query(`
+		UPDATE pr_reviewers r
+		SET reminded_at = CURRENT_TIMESTAMP
+		FROM pull_requests pr
+		JOIN users a ON a.user_id = pr.author_id
+		JOIN teams t ON t.team_name = a.team_name
+		WHERE r.pull_request_id = pr.pull_request_id AND pr.status = 'OPEN'
+			AND r.reminded_at IS NULL AND r.first_response_at IS NULL AND t.reminder_after_hours IS NOT NULL
+			AND r.assigned_at <= CURRENT_TIMESTAMP - make_interval(hours => t.reminder_after_hours)
+		RETURNING r.pull_request_id, r.user_id, pr.author_id
+	`)
+	if err != nil {
+		return err
+	}
+
+	var events []pendingEvent
+	for rows.Next() {
+		var payload EventPayload
+		if err := rows.Scan(&payload.PullRequestID, &payload.UserID, &payload.AuthorID); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		events = append(events, pendingEvent{EventReviewReminder, []string{payload.UserID}, payload})
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	if err := recordEvents(tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// escalateStaleReviews reassigns unanswered OPEN reviews past their team's escalation
+// threshold through the same flow as /pullRequest/reassign and notifies the team lead
+// with a review.escalated event. Reviews that cannot be reassigned stay put and are not
+// escalated again.
+func escalateStaleReviews() error {
+	rows, err := db.Query(`
+		SELECT r.pull_request_id, r.user_id, pr.author_id, COALESCE(t.lead_user_id, '')
+		FROM pr_reviewers r
+		JOIN pull_requests pr ON pr.pull_request_id = r.pull_request_id
+		JOIN users a ON a.user_id = pr.author_id
+		JOIN teams t ON t.team_name = a.team_name
+		WHERE pr.status = 'OPEN' AND r.escalated_at IS NULL AND r.first_response_at IS NULL AND t.escalate_after_hours IS NOT NULL
+			AND r.assigned_at <= CURRENT_TIMESTAMP - make_interval(hours => t.escalate_after_hours)
+		ORDER BY r.assigned_at
+		LIMIT $1
+	`, staleReviewBatch)
+	if err != nil {
+		return err
+	}
+
+	type staleReview struct {
+		EventPayload
+		LeadUserID string
+	}
+	var stale []staleReview
+	for rows.Next() {
+		var review staleReview
+		if err := rows.Scan(&review.PullRequestID, &review.OldUserID, &review.AuthorID, &review.LeadUserID); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		stale = append(stale, review)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for _, review := range stale {
+		if err := escalateStaleReview(review.EventPayload, review.LeadUserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escalateStaleReview reassigns one stale review and notifies leadUserID, if any.
+// payload names the PR, its author and the stale reviewer as OldUserID. A review
+// without a replacement is marked escalated so it is not retried; any other error is
+// returned and the review is retried on the next run.
+func escalateStaleReview(payload EventPayload, leadUserID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	newReviewerID, err := reassignReviewerTx(tx, PullRequestReassignRequest{PullRequestID: payload.PullRequestID, OldUserID: payload.OldUserID})
+	var apiErr *apiError
+	switch {
+	case err == nil:
+		log.Printf("Reassigned stale review on %s from %s to %s", payload.PullRequestID, payload.OldUserID, newReviewerID)
+		payload.NewUserID = newReviewerID
+	case errors.As(err, &apiErr):
+		log.Printf("Could not reassign stale review of %s on %s: %v", payload.OldUserID, payload.PullRequestID, err)
+		payload.Reason = err.Error()
+		_, err = tx.Exec("UPDATE pr_reviewers SET escalated_at = CURRENT_TIMESTAMP WHERE pull_request_id = $1 AND user_id = $2", payload.PullRequestID, payload.OldUserID)
+		if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	var recipients []string
+	if leadUserID != "" {
+		payload.UserID = leadUserID
+		recipients = []string{leadUserID}
+	}
+	if err := recordEvent(tx, EventReviewEscalated, recipients, payload); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStaleReviewsRemindAndEscalate(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, reminder_after_hours, escalate_after_hours) VALUES ('backend', 24, 72)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u4', 'Dave', 'backend', true)")
+	_, _ = testDB.Exec("UPDATE teams SET lead_user_id = 'u4' WHERE team_name = 'backend'")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Add feature', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1002', 'Fix bug', 'u1', 'OPEN')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id, assigned_at) VALUES ('pr-1001', 'u2', CURRENT_TIMESTAMP - INTERVAL '30 hours')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id, assigned_at) VALUES ('pr-1002', 'u3', CURRENT_TIMESTAMP - INTERVAL '80 hours')")
+
+	// Another replica holding the lock makes the run a no-op
+	holder, err := testDB.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = holder.ExecContext(context.Background(), "SELECT pg_advisory_lock($1)", staleReviewLockKey)
+	if err := processStaleReviews(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var events int
+	_ = testDB.QueryRow("SELECT COUNT(*) FROM events").Scan(&events)
+	if events != 0 {
+		t.Errorf("Expected nothing while the lock is held, got %d events", events)
+	}
+	_, _ = holder.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", staleReviewLockKey)
+	_ = holder.Close()
+
+	if err := processStaleReviews(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var reminded int
+	_ = testDB.QueryRow("SELECT COUNT(*) FROM events WHERE event_type = 'review.reminder'").Scan(&reminded)
+	if reminded != 2 {
+		t.Errorf("Expected both reviewers to be reminded, got %d reminders", reminded)
+	}
+
+	reviewers := getCurrentReviewers(db, "pr-1002")
+	if len(reviewers) != 1 || reviewers[0] == "u3" {
+		t.Errorf("Expected the 80 hour old review to be reassigned, got %v", reviewers)
+	}
+	var escalated int
+	_ = testDB.QueryRow("SELECT COUNT(*) FROM events WHERE event_type = 'review.escalated' AND 'u4' = ANY(recipients)").Scan(&escalated)
+	if escalated != 1 {
+		t.Errorf("Expected the lead to be told about 1 escalation, got %d", escalated)
+	}
+
+	// A second run finds nothing new
+	if err := processStaleReviews(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_ = testDB.QueryRow("SELECT COUNT(*) FROM events WHERE event_type IN ('review.reminder', 'review.escalated')").Scan(&events)
+	if events != 3 {
+		t.Errorf("Expected no repeated notifications, got %d", events)
+	}
+}
+
+func TestSetSettingsChecksStoredEscalationOrder(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name, reminder_after_hours, escalate_after_hours) VALUES ('backend', 24, 72)")
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"team_name": "backend", "escalate_after_hours": 12}`, http.StatusBadRequest},
+		{`{"team_name": "backend", "reminder_after_hours": 72}`, http.StatusBadRequest},
+		{`{"team_name": "backend", "reminder_after_hours": 48}`, http.StatusOK},
+		{`{"team_name": "backend", "escalate_after_hours": null}`, http.StatusOK},
+		{`{"team_name": "backend", "reminder_after_hours": 100}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		teamSetSettingsHandler(w, httptest.NewRequest(http.MethodPost, "/team/setSettings", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.body, tt.status, w.Code, w.Body.String())
+		}
+	}
+
+	var escalateAfter sql.NullInt64
+	_ = testDB.QueryRow("SELECT escalate_after_hours FROM teams WHERE team_name = 'backend'").Scan(&escalateAfter)
+	if escalateAfter.Valid {
+		t.Errorf("Expected escalation to stay cleared, got %d", escalateAfter.Int64)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultStatsLimit is how many reviewers /stats lists without a limit parameter
+const defaultStatsLimit = 10
+
+// statsDateFields are the PR columns the from/to range of /stats may apply to
+var statsDateFields = []string{"created_at", "merged_at"}
+
+// statsFilter narrows /stats down to one team and a PR date range
+type statsFilter struct {
+	TeamName string
+	// DateField is the pull_requests column From and To apply to, one of statsDateFields
+	DateField string
+	From, To  *time.Time
+	Limit     int
+}
+
+// parseTimeParam reads an optional RFC 3339 query parameter, returning nil when it is absent
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+func parseStatsFilter(query url.Values) (statsFilter, error) {
+	filter := statsFilter{TeamName: query.Get("team_name"), DateField: "created_at", Limit: defaultStatsLimit}
+
+	if v := query.Get("date_field"); v != "" {
+		if !containsString(statsDateFields, v) {
+			return filter, fmt.Errorf("date_field must be created_at or merged_at")
+		}
+		filter.DateField = v
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam(query, "to"); err != nil {
+		return filter, err
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, fmt.Errorf("limit must be a positive integer")
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// args are the query arguments every stats query takes: $1 team, $2 from and $3 to
+func (f statsFilter) args() []interface{} {
+	return []interface{}{f.TeamName, f.From, f.To}
+}
+
+// dateCondition keeps the PRs aliased pr whose date field falls within the range
+func (f statsFilter) dateCondition(pr string) string {
+	column := pr + "." + f.DateField
+	return fmt.Sprintf("($2::timestamp IS NULL OR %[1]s >= $2) AND ($3::timestamp IS NULL OR %[1]s < $3)", column)
+}
+
+type UserStats struct {
+	UserID        string `json:"user_id"`
+	Username      string `json:"username"`
+	ReviewCount   int    `json:"review_count"`
+	AuthoredPRs   int    `json:"authored_prs"`
+	OpenReviews   int    `json:"open_reviews"`
+	MergedReviews int    `json:"merged_reviews"`
+}
+
+// MergeTimes summarises the time from creating a PR to merging it, in hours.
+// Median and P90 are absent when nothing was merged.
+type MergeTimes struct {
+	Merged int      `json:"merged"`
+	Median *float64 `json:"median_hours,omitempty"`
+	P90    *float64 `json:"p90_hours,omitempty"`
+}
+
+// TeamStats are the PRs authored by one team's members
+type TeamStats struct {
+	TeamName      string     `json:"team_name"`
+	Members       int        `json:"members"`
+	ActiveMembers int        `json:"active_members"`
+	TotalPRs      int        `json:"total_prs"`
+	OpenPRs       int        `json:"open_prs"`
+	MergedPRs     int        `json:"merged_prs"`
+	TimeToMerge   MergeTimes `json:"time_to_merge"`
+}
+
+// WeeklyReviews is how many reviews a user was assigned in the week starting on Week
+type WeeklyReviews struct {
+	UserID  string `json:"user_id"`
+	Week    string `json:"week"`
+	Reviews int    `json:"reviews"`
+}
+
+type Stats struct {
+	TotalTeams     int             `json:"total_teams"`
+	TotalUsers     int             `json:"total_users"`
+	ActiveUsers    int             `json:"active_users"`
+	TotalPRs       int             `json:"total_prs"`
+	OpenPRs        int             `json:"open_prs"`
+	MergedPRs      int             `json:"merged_prs"`
+	TimeToMerge    MergeTimes      `json:"time_to_merge"`
+	TopReviewers   []UserStats     `json:"top_reviewers"`
+	Teams          []TeamStats     `json:"teams"`
+	ReviewsPerWeek []WeeklyReviews `json:"reviews_per_week"`
+}
+
+// mergeTimesColumns aggregates the merge times of the PRs aliased pr
+const mergeTimesColumns = `
+	COUNT(*) FILTER (WHERE pr.status = 'MERGED'),
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM pr.merged_at - pr.created_at) / 3600) FILTER (WHERE pr.status = 'MERGED'),
+	percentile_cont(0.9) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM pr.merged_at - pr.created_at) / 3600) FILTER (WHERE pr.status = 'MERGED')`
+
+func (m *MergeTimes) set(median, p90 sql.NullFloat64) {
+	if median.Valid {
+		m.Median = &median.Float64
+	}
+	if p90.Valid {
+		m.P90 = &p90.Float64
+	}
+}
+
+// statsHandler reports usage statistics. team_name limits PRs to those authored by the
+// team and reviewers to its members; from and to (RFC 3339) limit PRs by date_field.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseStatsFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if filter.TeamName != "" {
+		exists, err := teamExists(filter.TeamName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			sendError(w, http.StatusNotFound, "NOT_FOUND", "team not found")
+			return
+		}
+	}
+
+	var stats Stats
+	args := filter.args()
+
+	// Get totals
+	if err := db.QueryRow("SELECT COUNT(*) FROM teams WHERE $1 = '' OR team_name = $1", filter.TeamName).Scan(&stats.TotalTeams); err != nil {
+		log.Printf("Error getting total teams: %v", err)
+	}
+	err = db.QueryRow("SELECT COUNT(*), COUNT(*) FILTER (WHERE is_active) FROM users WHERE $1 = '' OR team_name = $1", filter.TeamName).
+		Scan(&stats.TotalUsers, &stats.ActiveUsers)
+	if err != nil {
+		log.Printf("Error getting total users: %v", err)
+	}
+
+	var median, p90 sql.NullFloat64
+	err = db.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE pr.status = 'OPEN'), `+mergeTimesColumns+`
+		FROM pull_requests pr
+		JOIN users a ON a.user_id = pr.author_id
+		WHERE ($1 = '' OR a.team_name = $1) AND `+filter.dateCondition("pr"), args...).
+		Scan(&stats.TotalPRs, &stats.OpenPRs, &stats.TimeToMerge.Merged, &median, &p90)
+	if err != nil {
+		log.Printf("Error getting PR totals: %v", err)
+	}
+	stats.MergedPRs = stats.TimeToMerge.Merged
+	stats.TimeToMerge.set(median, p90)
+
+	stats.TopReviewers = loadTopReviewers(filter)
+	stats.Teams = loadTeamStats(filter)
+	stats.ReviewsPerWeek = loadReviewsPerWeek(filter)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func loadTopReviewers(filter statsFilter) []UserStats {
+	topReviewers := []UserStats{}
+	rows, err := db.Query(`
+		SELECT
+			u.user_id,
+			u.username,
+			COUNT(r.pull_request_id) as review_count,
+			(SELECT COUNT(*) FROM pull_requests pa WHERE pa.author_id = u.user_id AND `+filter.dateCondition("pa")+`) as authored_prs,
+			COUNT(r.pull_request_id) FILTER (WHERE pr.status = 'OPEN') as open_reviews,
+			COUNT(r.pull_request_id) FILTER (WHERE pr.status = 'MERGED') as merged_reviews
+		FROM users u
+		LEFT JOIN (pr_reviewers r JOIN pull_requests pr ON r.pull_request_id = pr.pull_request_id AND `+filter.dateCondition("pr")+`)
+			ON u.user_id = r.user_id
+		WHERE $1 = '' OR u.team_name = $1
+		GROUP BY u.user_id, u.username
+		ORDER BY review_count DESC, u.user_id
+		LIMIT $4
+	`, append(filter.args(), filter.Limit)...)
+	if err != nil {
+		log.Printf("Error getting top reviewers: %v", err)
+		return topReviewers
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var us UserStats
+		if err := rows.Scan(&us.UserID, &us.Username, &us.ReviewCount, &us.AuthoredPRs, &us.OpenReviews, &us.MergedReviews); err != nil {
+			log.Printf("Error scanning user stats: %v", err)
+			continue
+		}
+		topReviewers = append(topReviewers, us)
+	}
+	return topReviewers
+}
+
+func loadTeamStats(filter statsFilter) []TeamStats {
+	teams := []TeamStats{}
+	rows, err := db.Query(`
+		SELECT
+			t.team_name,
+			(SELECT COUNT(*) FROM users m WHERE m.team_name = t.team_name),
+			(SELECT COUNT(*) FROM users m WHERE m.team_name = t.team_name AND m.is_active),
+			COUNT(pr.pull_request_id),
+			COUNT(pr.pull_request_id) FILTER (WHERE pr.status = 'OPEN'), `+mergeTimesColumns+`
+		FROM teams t
+		LEFT JOIN (users a JOIN pull_requests pr ON pr.author_id = a.user_id AND `+filter.dateCondition("pr")+`)
+			ON a.team_name = t.team_name
+		WHERE $1 = '' OR t.team_name = $1
+		GROUP BY t.team_name
+		ORDER BY t.team_name
+	`, filter.args()...)
+	if err != nil {
+		log.Printf("Error getting team stats: %v", err)
+		return teams
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var ts TeamStats
+		var median, p90 sql.NullFloat64
+		if err := rows.Scan(&ts.TeamName, &ts.Members, &ts.ActiveMembers, &ts.TotalPRs, &ts.OpenPRs, &ts.TimeToMerge.Merged, &median, &p90); err != nil {
+			log.Printf("Error scanning team stats: %v", err)
+			continue
+		}
+		ts.MergedPRs = ts.TimeToMerge.Merged
+		ts.TimeToMerge.set(median, p90)
+		teams = append(teams, ts)
+	}
+	return teams
+}
+
+// loadReviewsPerWeek counts the reviews of every user by the week they were assigned,
+// which starts on Monday
+func loadReviewsPerWeek(filter statsFilter) []WeeklyReviews {
+	weekly := []WeeklyReviews{}
+	rows, err := db.Query(`
+		SELECT r.user_id, date_trunc('week', r.assigned_at) AS week, COUNT(*)
+		FROM pr_reviewers r
+		JOIN pull_requests pr ON pr.pull_request_id = r.pull_request_id
+		JOIN users u ON u.user_id = r.user_id
+		WHERE ($1 = '' OR u.team_name = $1) AND `+filter.dateCondition("pr")+`
+		GROUP BY r.user_id, week
+		ORDER BY week, r.user_id
+	`, filter.args()...)
+	if err != nil {
+		log.Printf("Error getting reviews per week: %v", err)
+		return weekly
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var wr WeeklyReviews
+		var week time.Time
+		if err := rows.Scan(&wr.UserID, &week, &wr.Reviews); err != nil {
+			log.Printf("Error scanning reviews per week: %v", err)
+			continue
+		}
+		wr.Week = week.Format("2006-01-02")
+		weekly = append(weekly, wr)
+	}
+	return weekly
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseStatsFilter(t *testing.T) {
+	filter, err := parseStatsFilter(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.DateField != "created_at" || filter.Limit != defaultStatsLimit || filter.From != nil || filter.To != nil {
+		t.Errorf("Expected all-time defaults, got %+v", filter)
+	}
+
+	filter, err = parseStatsFilter(url.Values{"date_field": {"merged_at"}, "from": {"2025-03-01T03:00:00+03:00"}, "limit": {"3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.DateField != "merged_at" || filter.Limit != 3 || filter.From == nil || filter.From.Hour() != 0 {
+		t.Errorf("Expected merged_at from 2025-03-01T00:00:00Z with limit 3, got %+v", filter)
+	}
+
+	for _, query := range []url.Values{
+		{"date_field": {"updated_at"}},
+		{"limit": {"0"}},
+		{"limit": {"ten"}},
+		{"from": {"2025-03-01"}},
+		{"from": {"2025-03-02T00:00:00Z"}, "to": {"2025-03-01T00:00:00Z"}},
+	} {
+		if _, err := parseStatsFilter(query); err == nil {
+			t.Errorf("Expected %v to be rejected", query)
+		}
+	}
+}
+
+func TestStatsFilters(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend'), ('frontend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'frontend', true)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status, created_at, merged_at) VALUES ('pr-1', 'A', 'u1', 'MERGED', '2025-03-03 00:00', '2025-03-03 10:00')")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status, created_at, merged_at) VALUES ('pr-2', 'B', 'u1', 'MERGED', '2025-03-04 00:00', '2025-03-04 20:00')")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status, created_at) VALUES ('pr-3', 'C', 'u3', 'OPEN', '2025-04-01 00:00')")
+	_, _ = testDB.Exec("INSERT INTO pr_reviewers (pull_request_id, user_id, assigned_at) VALUES ('pr-1', 'u2', '2025-03-03 00:00'), ('pr-2', 'u2', '2025-03-04 00:00'), ('pr-3', 'u2', '2025-04-01 00:00')")
+
+	stats := func(query string) Stats {
+		w := httptest.NewRecorder()
+		statsHandler(w, httptest.NewRequest(http.MethodGet, "/stats"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var s Stats
+		_ = json.Unmarshal(w.Body.Bytes(), &s)
+		return s
+	}
+
+	all := stats("")
+	if all.TotalPRs != 3 || all.MergedPRs != 2 || len(all.Teams) != 2 {
+		t.Errorf("Expected 3 PRs over 2 teams, got %+v", all)
+	}
+	if m := all.TimeToMerge; m.Median == nil || *m.Median != 15 || m.P90 == nil || *m.P90 != 19 {
+		t.Errorf("Expected a 15 hour median and 19 hour p90 time to merge, got %+v", m)
+	}
+
+	march := stats("?team_name=backend&from=2025-03-01T00:00:00Z&to=2025-04-01T00:00:00Z&limit=1")
+	if march.TotalPRs != 2 || march.TotalTeams != 1 || len(march.Teams) != 1 || march.Teams[0].MergedPRs != 2 {
+		t.Errorf("Expected backend's 2 March PRs, got %+v", march)
+	}
+	if len(march.TopReviewers) != 1 || march.TopReviewers[0].UserID != "u2" || march.TopReviewers[0].ReviewCount != 2 {
+		t.Errorf("Expected u2 with 2 reviews as the only top reviewer, got %+v", march.TopReviewers)
+	}
+	if len(march.ReviewsPerWeek) != 1 || march.ReviewsPerWeek[0].Week != "2025-03-03" || march.ReviewsPerWeek[0].Reviews != 2 {
+		t.Errorf("Expected 2 reviews in the week of 2025-03-03, got %+v", march.ReviewsPerWeek)
+	}
+
+	w := httptest.NewRecorder()
+	statsHandler(w, httptest.NewRequest(http.MethodGet, "/stats?team_name=mobile", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown team, got %d", w.Code)
+	}
+}
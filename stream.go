@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// eventChannel is the Postgres NOTIFY channel carrying ids of committed events
+const eventChannel = "review_events"
+
+// streamReplayBatch is how many missed events one replay query loads
+const streamReplayBatch = 1000
+
+// streamDedupeWindow is how many sent event ids a stream remembers to skip live copies of
+// events it already replayed
+const streamDedupeWindow = 4096
+
+// StreamEvent is an event as seen by one user's stream
+type StreamEvent struct {
+	Event
+	Recipients []string `json:"-"`
+}
+
+// eventBroker fans events out to the open review streams of this instance
+type eventBroker struct {
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[string]map[chan StreamEvent]struct{}
+}
+
+var broker = newEventBroker()
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: map[string]map[chan StreamEvent]struct{}{}}
+}
+
+// subscribe registers a stream for userID. The channel is closed when the broker shuts down.
+func (b *eventBroker) subscribe(userID string) chan StreamEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan StreamEvent, 16)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = map[chan StreamEvent]struct{}{}
+	}
+	b.subscribers[userID][ch] = struct{}{}
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(userID string, ch chan StreamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[userID][ch]; !ok {
+		return
+	}
+	delete(b.subscribers[userID], ch)
+	if len(b.subscribers[userID]) == 0 {
+		delete(b.subscribers, userID)
+	}
+	close(ch)
+}
+
+// publish hands the event to every stream of its recipients. A stream that cannot
+// keep up is closed instead of silently losing the event: its handler ends the
+// response and the client reconnects, replaying the rest with Last-Event-ID.
+func (b *eventBroker) publish(event StreamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, userID := range event.Recipients {
+		for ch := range b.subscribers[userID] {
+			select {
+			case ch <- event:
+			default:
+				log.Printf("Closing slow stream of %s at event %d", userID, event.ID)
+				delete(b.subscribers[userID], ch)
+				close(ch)
+			}
+		}
+		if len(b.subscribers[userID]) == 0 {
+			delete(b.subscribers, userID)
+		}
+	}
+}
+
+// hasSubscribers lets the listener skip loading events nobody is waiting for
+func (b *eventBroker) hasSubscribers() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers) > 0
+}
+
+// close ends every open stream so graceful shutdown does not wait on them
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for userID, chans := range b.subscribers {
+		for ch := range chans {
+			close(ch)
+		}
+		delete(b.subscribers, userID)
+	}
+}
+
+// runEventListener LISTENs for committed events, so streams on every replica see
+// changes made through any other replica
+func runEventListener(ctx context.Context, databaseURL string) {
+	listener := pq.NewListener(databaseURL, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event listener: %v", err)
+		}
+	})
+	defer func() {
+		if err := listener.Close(); err != nil {
+			log.Printf("Error closing event listener: %v", err)
+		}
+	}()
+
+	if err := listener.Listen(eventChannel); err != nil {
+		log.Printf("Error listening on %s: %v", eventChannel, err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			// nil means the connection was re-established; missed events are
+			// recovered by clients through Last-Event-ID
+			if n == nil || !broker.hasSubscribers() {
+				continue
+			}
+			eventID, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				log.Printf("Invalid event notification %q", n.Extra)
+				continue
+			}
+			event, err := loadStreamEvent(eventID)
+			if err != nil {
+				log.Printf("Error loading event %d: %v", eventID, err)
+				continue
+			}
+			broker.publish(event)
+		case <-time.After(90 * time.Second):
+			if err := listener.Ping(); err != nil {
+				log.Printf("Event listener ping failed: %v", err)
+			}
+		}
+	}
+}
+
+// sentEvents remembers the most recent event ids written to one stream. Ids are not
+// compared by order because BIGSERIAL ids can commit out of order.
+type sentEvents struct {
+	ids   map[int64]struct{}
+	order []int64
+}
+
+func newSentEvents() *sentEvents {
+	return &sentEvents{ids: map[int64]struct{}{}}
+}
+
+func (s *sentEvents) has(id int64) bool {
+	_, ok := s.ids[id]
+	return ok
+}
+
+func (s *sentEvents) add(id int64) {
+	if s.has(id) {
+		return
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
+	if len(s.order) > streamDedupeWindow {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func loadStreamEvent(eventID int64) (StreamEvent, error) {
+	var event StreamEvent
+	var payload string
+	var createdAt time.Time
+	err := db.QueryRow(`
+		SELECT id, event_type, payload, created_at, recipients FROM events WHERE id = $1
+	`, eventID).Scan(&event.ID, &event.Type, &payload, &createdAt, pq.Array(&event.Recipients))
+	if err != nil {
+		return event, err
+	}
+	event.Data = json.RawMessage(payload)
+	event.CreatedAt = createdAt.Format(time.RFC3339)
+	return event, nil
+}
+
+// usersReviewStreamHandler streams the user's assignment events as Server-Sent Events.
+// Reconnecting clients send Last-Event-ID (or ?last_event_id=) to replay what they missed.
+func usersReviewStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		var err error
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Last-Event-ID must be an integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1)", userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "user not found")
+		return
+	}
+
+	// Subscribe before replaying so nothing committed in between is lost
+	events := broker.subscribe(userID)
+	defer broker.unsubscribe(userID, events)
+
+	// The stream outlives the server's WriteTimeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("Error flushing stream: %v", err)
+		return
+	}
+
+	sent := newSentEvents()
+	if lastEventID != "" {
+		if err := replayStreamEvents(w, userID, lastID, sent); err != nil {
+			log.Printf("Error replaying events for %s: %v", userID, err)
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(envDuration("STREAM_HEARTBEAT_INTERVAL", 15*time.Second))
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			// Already sent during replay
+			if sent.has(event.ID) {
+				continue
+			}
+			if err := writeStreamEvent(w, userID, event.Event); err != nil {
+				return
+			}
+			sent.add(event.ID)
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// replayStreamEvents writes all of the user's events after lastID, a page at a time,
+// and adds them to sent
+func replayStreamEvents(w http.ResponseWriter, userID string, lastID int64, sent *sentEvents) error {
+	for {
+		count, err := replayStreamPage(w, userID, &lastID, sent)
+		if err != nil {
+			return err
+		}
+		if count < streamReplayBatch {
+			return nil
+		}
+	}
+}
+
+// replayStreamPage writes up to streamReplayBatch events after *lastID, advancing it,
+// and returns how many it wrote
+func replayStreamPage(w http.ResponseWriter, userID string, lastID *int64, sent *sentEvents) (int, error) {
+	rows, err := db.Query(`
+		SELECT id, event_type, payload, created_at FROM events
+		WHERE $1 = ANY(recipients) AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`, userID, *lastID, streamReplayBatch)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	count := 0
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return count, err
+		}
+		if err := writeStreamEvent(w, userID, event); err != nil {
+			return count, err
+		}
+		sent.add(event.ID)
+		*lastID = event.ID
+		count++
+	}
+	return count, rows.Err()
+}
+
+func writeStreamEvent(w http.ResponseWriter, userID string, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, streamEventName(userID, event), data)
+	return err
+}
+
+// streamEventName names the event from the point of view of userID: a reassignment
+// is "assigned" for the new reviewer and "unassigned" for the old one
+func streamEventName(userID string, event Event) string {
+	switch event.Type {
+	case EventReviewerAssigned:
+		return "assigned"
+	case EventReviewerUnassigned:
+		return "unassigned"
+	case EventReviewerReassigned:
+		var payload EventPayload
+		if err := json.Unmarshal(event.Data, &payload); err == nil && payload.NewUserID == userID {
+			return "assigned"
+		}
+		return "unassigned"
+	case EventPullRequestMerged:
+		return "merged"
+	case EventPullRequestClosed:
+		return "closed"
+	case EventPullRequestReopened:
+		return "reopened"
+	case EventReviewReminder:
+		return "reminder"
+	case EventReviewEscalated:
+		return "escalated"
+	default:
+		return event.Type
+	}
+}
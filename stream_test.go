@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamEventName(t *testing.T) {
+	reassigned := Event{
+		Type: EventReviewerReassigned,
+		Data: json.RawMessage(`{"pull_request_id":"pr-1","old_user_id":"u2","new_user_id":"u3"}`),
+	}
+	if got := streamEventName("u3", reassigned); got != "assigned" {
+		t.Errorf("Expected assigned for new reviewer, got %s", got)
+	}
+	if got := streamEventName("u2", reassigned); got != "unassigned" {
+		t.Errorf("Expected unassigned for old reviewer, got %s", got)
+	}
+	if got := streamEventName("u2", Event{Type: EventPullRequestMerged}); got != "merged" {
+		t.Errorf("Expected merged, got %s", got)
+	}
+}
+
+func TestEventBrokerFanOut(t *testing.T) {
+	b := newEventBroker()
+	bob := b.subscribe("u2")
+	carol := b.subscribe("u3")
+	defer b.unsubscribe("u3", carol)
+
+	b.publish(StreamEvent{Event: Event{ID: 1, Type: EventReviewerAssigned}, Recipients: []string{"u2"}})
+
+	select {
+	case event := <-bob:
+		if event.ID != 1 {
+			t.Errorf("Expected event 1, got %d", event.ID)
+		}
+	default:
+		t.Error("Expected event for u2")
+	}
+	select {
+	case event := <-carol:
+		t.Errorf("u3 should not receive event %d", event.ID)
+	default:
+	}
+
+	b.unsubscribe("u2", bob)
+	if _, ok := <-bob; ok {
+		t.Error("Expected channel to be closed after unsubscribe")
+	}
+
+	b.close()
+	if _, ok := <-carol; ok {
+		t.Error("Expected channel to be closed on broker shutdown")
+	}
+}
+
+func TestEventBrokerClosesSlowStream(t *testing.T) {
+	b := newEventBroker()
+	slow := b.subscribe("u2")
+	defer b.unsubscribe("u2", slow)
+
+	for id := int64(1); id <= 17; id++ {
+		b.publish(StreamEvent{Event: Event{ID: id, Type: EventReviewerAssigned}, Recipients: []string{"u2"}})
+	}
+
+	// The buffered events are still delivered, then the stream ends so the client reconnects
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != 16 {
+		t.Errorf("Expected the 16 buffered events, got %d", received)
+	}
+	if b.hasSubscribers() {
+		t.Error("Expected the slow stream to be unsubscribed")
+	}
+}
+
+func TestReviewStreamReplay(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u3', 'Charlie', 'backend', true)")
+
+	_ = recordEvent(testDB, EventReviewerAssigned, []string{"u2"}, EventPayload{PullRequestID: "pr-1", UserID: "u2"})
+	_ = recordEvent(testDB, EventReviewerAssigned, []string{"u3"}, EventPayload{PullRequestID: "pr-2", UserID: "u3"})
+	_ = recordEvent(testDB, EventReviewerReassigned, []string{"u2", "u3"}, EventPayload{PullRequestID: "pr-1", OldUserID: "u2", NewUserID: "u3"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/users/reviewStream?user_id=u2", nil).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", "0")
+	w := httptest.NewRecorder()
+
+	usersReviewStreamHandler(w, req)
+
+	body := w.Body.String()
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(body, "event: assigned") || !strings.Contains(body, "event: unassigned") {
+		t.Errorf("Expected assigned and unassigned events, got %q", body)
+	}
+	if strings.Contains(body, "pr-2") {
+		t.Errorf("Stream of u2 must not contain events of u3, got %q", body)
+	}
+}
+
+func TestSentEventsOutOfOrder(t *testing.T) {
+	sent := newSentEvents()
+	sent.add(11)
+	// Event 10 committed after 11 was sent and must still go out
+	if sent.has(10) {
+		t.Error("Expected event 10 not to count as sent")
+	}
+	if !sent.has(11) {
+		t.Error("Expected event 11 to count as sent")
+	}
+
+	for id := int64(100); id < 100+streamDedupeWindow; id++ {
+		sent.add(id)
+	}
+	if sent.has(11) || len(sent.ids) != streamDedupeWindow {
+		t.Errorf("Expected only the last %d ids to be kept, got %d", streamDedupeWindow, len(sent.ids))
+	}
+}
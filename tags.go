@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// normalizeTags lowercases and trims tags, dropping empty and repeated ones
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	normalized = uniqueStrings(normalized)
+	sort.Strings(normalized)
+	return normalized
+}
+
+// rankByTags orders the candidates of every tier by how many of the required tags they
+// carry, most first. Candidates without any of them stay eligible at the end.
+func rankByTags(q dbExecutor, tiers []candidateTier, required []string) []candidateTier {
+	if len(required) == 0 {
+		return tiers
+	}
+
+	var candidates []string
+	for _, tier := range tiers {
+		candidates = append(candidates, tier.UserIDs...)
+	}
+	return rankTiersByTags(tiers, loadTags(q, candidates), required)
+}
+
+func rankTiersByTags(tiers []candidateTier, tags map[string][]string, required []string) []candidateTier {
+	requiredSet := map[string]bool{}
+	for _, tag := range required {
+		requiredSet[tag] = true
+	}
+
+	overlap := map[string]int{}
+	for userID, userTags := range tags {
+		for _, tag := range userTags {
+			if requiredSet[tag] {
+				overlap[userID]++
+			}
+		}
+	}
+
+	var ranked []candidateTier
+	for score := len(requiredSet); score >= 0; score-- {
+		for _, tier := range tiers {
+			var userIDs []string
+			for _, userID := range tier.UserIDs {
+				if overlap[userID] == score {
+					userIDs = append(userIDs, userID)
+				}
+			}
+			reason := tier.Reason
+			if score > 0 {
+				reason = fmt.Sprintf("matches %d/%d required tags; %s", score, len(requiredSet), tier.Reason)
+			}
+			ranked = append(ranked, candidateTier{UserIDs: userIDs, Reason: reason})
+		}
+	}
+	return ranked
+}
+
+func loadTags(q dbExecutor, userIDs []string) map[string][]string {
+	tags := map[string][]string{}
+	if len(userIDs) == 0 {
+		return tags
+	}
+
+	rows, err := q.Query("SELECT user_id, tags FROM users WHERE user_id = ANY($1)", pq.Array(userIDs))
+	if err != nil {
+		log.Printf("Error loading tags: %v", err)
+		return tags
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var userID string
+		var userTags []string
+		if err := rows.Scan(&userID, pq.Array(&userTags)); err != nil {
+			continue
+		}
+		tags[userID] = userTags
+	}
+	return tags
+}
+
+// usersTagsHandler returns a user's skill tags on GET and replaces them on POST
+func usersTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var userID string
+	var tags []string
+
+	switch r.Method {
+	case http.MethodGet:
+		userID = r.URL.Query().Get("user_id")
+		if userID == "" {
+			http.Error(w, "user_id is required", http.StatusBadRequest)
+			return
+		}
+
+		err := db.QueryRow("SELECT tags FROM users WHERE user_id = $1", userID).Scan(pq.Array(&tags))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				sendError(w, http.StatusNotFound, "NOT_FOUND", "user not found")
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+	case http.MethodPost:
+		var req struct {
+			UserID string   `json:"user_id"`
+			Tags   []string `json:"tags"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		userID = req.UserID
+		tags = normalizeTags(req.Tags)
+		result, err := db.Exec("UPDATE users SET tags = $1 WHERE user_id = $2", pq.Array(tags), userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			sendError(w, http.StatusNotFound, "NOT_FOUND", "user not found")
+			return
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"tags":    tags,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
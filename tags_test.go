@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got := normalizeTags([]string{" Postgres", "go", "", "GO"})
+	want := []string{"go", "postgres"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestRankTiersByTags(t *testing.T) {
+	tiers := []candidateTier{
+		{UserIDs: []string{"u2", "u3"}, Reason: reasonWorkingHours},
+		{UserIDs: []string{"u4"}, Reason: reasonOffHours},
+	}
+	tags := map[string][]string{
+		"u2": {"frontend"},
+		"u3": {"go", "postgres"},
+		"u4": {"go"},
+	}
+
+	ranked := rankTiersByTags(tiers, tags, []string{"go", "postgres"})
+
+	var order []string
+	for _, tier := range ranked {
+		order = append(order, tier.UserIDs...)
+	}
+	if !reflect.DeepEqual(order, []string{"u3", "u4", "u2"}) {
+		t.Errorf("Expected candidates ordered by tag overlap, got %v", order)
+	}
+
+	slots := fillSlots(ranked, 1)
+	if slots[0].UserID != "u3" || slots[0].Reason != "matches 2/2 required tags; "+reasonWorkingHours {
+		t.Errorf("Unexpected slot %+v", slots[0])
+	}
+}
+
+func TestCreateRanksByRequiredTags(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, tags) VALUES ('u2', 'Bob', 'backend', true, '{frontend}')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, tags) VALUES ('u3', 'Charlie', 'backend', true, '{go,postgres}')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active, tags) VALUES ('u4', 'Dave', 'backend', true, '{postgres}')")
+
+	pr, _, err := createPullRequest(PullRequestCreateRequest{
+		PullRequestID:   "pr-1001",
+		PullRequestName: "Tune queries",
+		AuthorID:        "u1",
+		RequiredTags:    []string{"Postgres", "go"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pr.ReviewerSlots) != 2 || pr.ReviewerSlots[0].UserID != "u3" || pr.ReviewerSlots[1].UserID != "u4" {
+		t.Errorf("Expected u3 then u4 by tag overlap, got %+v", pr.ReviewerSlots)
+	}
+	if !reflect.DeepEqual(getPullRequest("pr-1001").RequiredTags, []string{"go", "postgres"}) {
+		t.Error("Expected required tags to be stored on the PR")
+	}
+}
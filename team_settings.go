@@ -0,0 +1,319 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// TeamSettings are the per-team knobs of reviewer assignment
+type TeamSettings struct {
+	TeamName              string `json:"team_name"`
+	DefaultMaxOpenReviews *int   `json:"default_max_open_reviews"`
+	// FallbackTeams lend reviewers, in this order, when the team has no candidate left
+	FallbackTeams []string `json:"fallback_teams"`
+	// MinReviewerSeniority requires at least one reviewer of this level or above on every PR
+	MinReviewerSeniority *string `json:"min_reviewer_seniority"`
+	// ReassignOnDeactivate hands over a member's OPEN reviews when /users/setIsActive
+	// deactivates them without saying otherwise
+	ReassignOnDeactivate bool `json:"reassign_on_deactivate"`
+	// ReminderAfterHours reminds a reviewer of a review left waiting this long
+	ReminderAfterHours *int `json:"reminder_after_hours"`
+	// EscalateAfterHours reassigns a review left waiting this long and tells the lead
+	EscalateAfterHours *int `json:"escalate_after_hours"`
+	// LeadUserID is notified of escalated reviews
+	LeadUserID *string `json:"lead_user_id"`
+	// SLAFirstReviewHours is the target time from assignment to a reviewer's first response
+	SLAFirstReviewHours *int `json:"sla_first_review_hours"`
+	// SLAMergeHours is the target time from creating a PR to merging it
+	SLAMergeHours *int `json:"sla_merge_hours"`
+}
+
+// nullable tells an omitted JSON field (Set is false) apart from an explicit null
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	return json.Unmarshal(data, &n.Value)
+}
+
+// TeamSettingsRequest is the body of /team/setSettings. Omitted fields keep their value.
+type TeamSettingsRequest struct {
+	TeamName              string           `json:"team_name"`
+	DefaultMaxOpenReviews nullable[int]    `json:"default_max_open_reviews"`
+	FallbackTeams         *[]string        `json:"fallback_teams"`
+	MinReviewerSeniority  nullable[string] `json:"min_reviewer_seniority"`
+	ReassignOnDeactivate  *bool            `json:"reassign_on_deactivate"`
+	ReminderAfterHours    nullable[int]    `json:"reminder_after_hours"`
+	EscalateAfterHours    nullable[int]    `json:"escalate_after_hours"`
+	LeadUserID            nullable[string] `json:"lead_user_id"`
+	SLAFirstReviewHours   nullable[int]    `json:"sla_first_review_hours"`
+	SLAMergeHours         nullable[int]    `json:"sla_merge_hours"`
+}
+
+func loadTeamSettings(teamName string) (TeamSettings, error) {
+	settings := TeamSettings{TeamName: teamName}
+	var defaultMax, reminderAfter, escalateAfter, slaFirstReview, slaMerge sql.NullInt64
+	var minSeniority, leadUserID sql.NullString
+	err := db.QueryRow(`
+		SELECT default_max_open_reviews, min_reviewer_seniority, reassign_on_deactivate,
+			reminder_after_hours, escalate_after_hours, lead_user_id, sla_first_review_hours, sla_merge_hours
+		FROM teams WHERE team_name = $1
+	`, teamName).Scan(&defaultMax, &minSeniority, &settings.ReassignOnDeactivate, &reminderAfter, &escalateAfter, &leadUserID, &slaFirstReview, &slaMerge)
+	if err != nil {
+		return settings, err
+	}
+	if reminderAfter.Valid {
+		value := int(reminderAfter.Int64)
+		settings.ReminderAfterHours = &value
+	}
+	if escalateAfter.Valid {
+		value := int(escalateAfter.Int64)
+		settings.EscalateAfterHours = &value
+	}
+	if leadUserID.Valid {
+		settings.LeadUserID = &leadUserID.String
+	}
+	if slaFirstReview.Valid {
+		value := int(slaFirstReview.Int64)
+		settings.SLAFirstReviewHours = &value
+	}
+	if slaMerge.Valid {
+		value := int(slaMerge.Int64)
+		settings.SLAMergeHours = &value
+	}
+	if defaultMax.Valid {
+		value := int(defaultMax.Int64)
+		settings.DefaultMaxOpenReviews = &value
+	}
+	if minSeniority.Valid {
+		settings.MinReviewerSeniority = &minSeniority.String
+	}
+	settings.FallbackTeams, err = loadFallbackTeams(db, teamName)
+	return settings, err
+}
+
+func teamGetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamName := r.URL.Query().Get("team_name")
+	if teamName == "" {
+		http.Error(w, "team_name is required", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := loadTeamSettings(teamName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendError(w, http.StatusNotFound, "NOT_FOUND", "team not found")
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"settings": settings}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func teamSetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TeamSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var assignments []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if req.DefaultMaxOpenReviews.Set {
+		if v := req.DefaultMaxOpenReviews.Value; v != nil && *v < 0 {
+			http.Error(w, "default_max_open_reviews must not be negative", http.StatusBadRequest)
+			return
+		}
+		set("default_max_open_reviews", req.DefaultMaxOpenReviews.Value)
+	}
+
+	if req.MinReviewerSeniority.Set {
+		if v := req.MinReviewerSeniority.Value; v != nil && seniorityRank(*v) == 0 {
+			http.Error(w, "min_reviewer_seniority must be one of "+strings.Join(seniorityLevels, ", "), http.StatusBadRequest)
+			return
+		}
+		set("min_reviewer_seniority", req.MinReviewerSeniority.Value)
+	}
+
+	if req.ReassignOnDeactivate != nil {
+		set("reassign_on_deactivate", *req.ReassignOnDeactivate)
+	}
+
+	if req.ReminderAfterHours.Set {
+		if v := req.ReminderAfterHours.Value; v != nil && *v <= 0 {
+			http.Error(w, "reminder_after_hours must be positive", http.StatusBadRequest)
+			return
+		}
+		set("reminder_after_hours", req.ReminderAfterHours.Value)
+	}
+
+	if req.EscalateAfterHours.Set {
+		if v := req.EscalateAfterHours.Value; v != nil && *v <= 0 {
+			http.Error(w, "escalate_after_hours must be positive", http.StatusBadRequest)
+			return
+		}
+		set("escalate_after_hours", req.EscalateAfterHours.Value)
+	}
+
+	if req.LeadUserID.Set {
+		if v := req.LeadUserID.Value; v != nil {
+			var exists bool
+			if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1)", *v).Scan(&exists); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !exists {
+				sendError(w, http.StatusNotFound, "NOT_FOUND", "lead user not found")
+				return
+			}
+		}
+		set("lead_user_id", req.LeadUserID.Value)
+	}
+
+	if req.SLAFirstReviewHours.Set {
+		if v := req.SLAFirstReviewHours.Value; v != nil && *v <= 0 {
+			http.Error(w, "sla_first_review_hours must be positive", http.StatusBadRequest)
+			return
+		}
+		set("sla_first_review_hours", req.SLAFirstReviewHours.Value)
+	}
+
+	if req.SLAMergeHours.Set {
+		if v := req.SLAMergeHours.Value; v != nil && *v <= 0 {
+			http.Error(w, "sla_merge_hours must be positive", http.StatusBadRequest)
+			return
+		}
+		set("sla_merge_hours", req.SLAMergeHours.Value)
+	}
+
+	var fallbackTeams []string
+	if req.FallbackTeams != nil {
+		fallbackTeams = uniqueStrings(*req.FallbackTeams)
+		if len(fallbackTeams) != len(*req.FallbackTeams) {
+			http.Error(w, "fallback_teams must not repeat a team", http.StatusBadRequest)
+			return
+		}
+		for _, team := range fallbackTeams {
+			if team == req.TeamName {
+				http.Error(w, "a team cannot be its own fallback", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	exists, err := teamExists(req.TeamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "team not found")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	if len(assignments) > 0 {
+		args = append(args, req.TeamName)
+		query := fmt.Sprintf("UPDATE teams SET %s WHERE team_name = $%d", strings.Join(assignments, ", "), len(args))
+		if _, err := tx.Exec(query, args...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Checked on the stored values so a request changing only one of them cannot invert the order
+	if req.ReminderAfterHours.Set || req.EscalateAfterHours.Set {
+		var reminderAfter, escalateAfter sql.NullInt64
+		err := tx.QueryRow("SELECT reminder_after_hours, escalate_after_hours FROM teams WHERE team_name = $1", req.TeamName).Scan(&reminderAfter, &escalateAfter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if reminderAfter.Valid && escalateAfter.Valid && escalateAfter.Int64 <= reminderAfter.Int64 {
+			http.Error(w, "escalate_after_hours must be greater than reminder_after_hours", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.FallbackTeams != nil {
+		var known int
+		err := tx.QueryRow("SELECT COUNT(*) FROM teams WHERE team_name = ANY($1)", pq.Array(fallbackTeams)).Scan(&known)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if known != len(fallbackTeams) {
+			sendError(w, http.StatusNotFound, "NOT_FOUND", "fallback team not found")
+			return
+		}
+
+		if _, err := tx.Exec("DELETE FROM team_fallbacks WHERE team_name = $1", req.TeamName); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i, team := range fallbackTeams {
+			_, err := tx.Exec("INSERT INTO team_fallbacks (team_name, position, fallback_team) VALUES ($1, $2, $3)", req.TeamName, i+1, team)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := loadTeamSettings(req.TeamName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"settings": settings}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
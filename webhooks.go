@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Delivery statuses of webhook_deliveries
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+// WebhookSubscription is a registered receiver of events. The secret is never returned.
+type WebhookSubscription struct {
+	ID         int64    `json:"id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// WebhookDelivery is one attempt to hand an event to a subscription
+type WebhookDelivery struct {
+	ID             int64   `json:"id"`
+	SubscriptionID int64   `json:"subscription_id"`
+	EventID        int64   `json:"event_id"`
+	EventType      string  `json:"event_type"`
+	Status         string  `json:"status"`
+	Attempts       int     `json:"attempts"`
+	NextAttemptAt  *string `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int    `json:"last_status_code,omitempty"`
+	LastError      *string `json:"last_error,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+	DeliveredAt    *string `json:"delivered_at,omitempty"`
+}
+
+// webhookTimeout bounds a single delivery attempt
+const webhookTimeout = 10 * time.Second
+
+// webhookBatchSize is how many deliveries one dispatch claims and sends one by one
+const webhookBatchSize = 20
+
+// webhookLease keeps claimed deliveries away from other replicas for longer than a
+// whole batch of timed out attempts can take
+const webhookLease = webhookBatchSize*webhookTimeout + time.Minute
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+func webhookAddHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Secret     string   `json:"secret"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if req.Secret == "" {
+		http.Error(w, "secret is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.EventTypes) == 0 {
+		http.Error(w, "event_types is required", http.StatusBadRequest)
+		return
+	}
+	for _, eventType := range req.EventTypes {
+		if !eventTypes[eventType] {
+			http.Error(w, "unknown event type: "+eventType, http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub := WebhookSubscription{URL: req.URL, EventTypes: req.EventTypes}
+	var createdAt time.Time
+	err = db.QueryRow(`
+		INSERT INTO webhook_subscriptions (url, event_types, secret)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, req.URL, pq.Array(req.EventTypes), req.Secret).Scan(&sub.ID, &createdAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sub.CreatedAt = createdAt.Format(time.RFC3339)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"subscription": sub}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func webhookListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, err := db.Query("SELECT id, url, event_types, created_at FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		var sub WebhookSubscription
+		var createdAt time.Time
+		if err := rows.Scan(&sub.ID, &sub.URL, pq.Array(&sub.EventTypes), &createdAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sub.CreatedAt = createdAt.Format(time.RFC3339)
+		subscriptions = append(subscriptions, sub)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"subscriptions": subscriptions}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func webhookDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Pending deliveries go away with the subscription (ON DELETE CASCADE)
+	result, err := db.Exec("DELETE FROM webhook_subscriptions WHERE id = $1", req.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		sendError(w, http.StatusNotFound, "NOT_FOUND", "subscription not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"deleted": req.ID}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// webhookDeliveriesHandler returns the delivery log, newest first, optionally
+// filtered by subscription_id and status
+func webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := `
+		SELECT d.id, d.subscription_id, d.event_id, e.event_type, d.status, d.attempts,
+			d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN events e ON e.id = d.event_id
+		WHERE 1 = 1`
+	var args []interface{}
+
+	if raw := r.URL.Query().Get("subscription_id"); raw != "" {
+		subscriptionID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			http.Error(w, "subscription_id must be an integer", http.StatusBadRequest)
+			return
+		}
+		args = append(args, subscriptionID)
+		query += fmt.Sprintf(" AND d.subscription_id = $%d", len(args))
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		if status != deliveryPending && status != deliveryDelivered && status != deliveryFailed {
+			http.Error(w, "status must be one of pending, delivered, failed", http.StatusBadRequest)
+			return
+		}
+		args = append(args, status)
+		query += fmt.Sprintf(" AND d.status = $%d", len(args))
+	}
+	query += " ORDER BY d.id DESC LIMIT 100"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"deliveries": deliveries}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// webhookRedeliverHandler queues a fresh delivery of the same event to the same
+// subscription, keeping the original entry in the log untouched
+func webhookRedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		DeliveryID int64 `json:"delivery_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var newID int64
+	err := db.QueryRow(`
+		INSERT INTO webhook_deliveries (subscription_id, event_id)
+		SELECT subscription_id, event_id FROM webhook_deliveries WHERE id = $1
+		RETURNING id
+	`, req.DeliveryID).Scan(&newID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendError(w, http.StatusNotFound, "NOT_FOUND", "delivery not found")
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	row := db.QueryRow(`
+		SELECT d.id, d.subscription_id, d.event_id, e.event_type, d.status, d.attempts,
+			d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN events e ON e.id = d.event_id
+		WHERE d.id = $1
+	`, newID)
+	delivery, err := scanDelivery(row)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"delivery": delivery}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var nextAttemptAt, deliveredAt sql.NullTime
+	var createdAt time.Time
+	var lastStatusCode sql.NullInt64
+	var lastError sql.NullString
+
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+		&nextAttemptAt, &lastStatusCode, &lastError, &createdAt, &deliveredAt)
+	if err != nil {
+		return d, err
+	}
+
+	d.CreatedAt = createdAt.Format(time.RFC3339)
+	if d.Status == deliveryPending && nextAttemptAt.Valid {
+		next := nextAttemptAt.Time.Format(time.RFC3339)
+		d.NextAttemptAt = &next
+	}
+	if lastStatusCode.Valid {
+		code := int(lastStatusCode.Int64)
+		d.LastStatusCode = &code
+	}
+	if lastError.Valid {
+		d.LastError = &lastError.String
+	}
+	if deliveredAt.Valid {
+		delivered := deliveredAt.Time.Format(time.RFC3339)
+		d.DeliveredAt = &delivered
+	}
+	return d, nil
+}
+
+// runWebhookDispatcher polls the delivery queue until ctx is canceled
+func runWebhookDispatcher(ctx context.Context) {
+	interval := envDuration("WEBHOOK_POLL_INTERVAL", 2*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := dispatchWebhooks(ctx); err != nil {
+				log.Printf("Error dispatching webhooks: %v", err)
+			}
+		}
+	}
+}
+
+// dispatchWebhooks sends one batch of due deliveries. Claimed rows are leased by
+// pushing next_attempt_at forward so other replicas skip them while we send.
+func dispatchWebhooks(ctx context.Context) error {
+	maxAttempts := envInt("WEBHOOK_MAX_ATTEMPTS", 8)
+
+	rows, err := db.QueryContext(ctx, `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1)
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+				ORDER BY next_attempt_at
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, subscription_id, event_id, attempts
+		)
+		SELECT c.id, c.attempts, s.url, s.secret, e.id, e.event_type, e.payload, e.created_at
+		FROM claimed c
+		JOIN webhook_subscriptions s ON s.id = c.subscription_id
+		JOIN events e ON e.id = c.event_id
+	`, webhookLease.Seconds(), webhookBatchSize)
+	if err != nil {
+		return err
+	}
+
+	type claimedDelivery struct {
+		ID       int64
+		Attempts int
+		URL      string
+		Secret   string
+		Event    Event
+	}
+	var batch []claimedDelivery
+	err = func() error {
+		defer func() {
+			if err := rows.Close(); err != nil {
+				log.Printf("Error closing rows: %v", err)
+			}
+		}()
+		for rows.Next() {
+			var d claimedDelivery
+			var payload string
+			var createdAt time.Time
+			if err := rows.Scan(&d.ID, &d.Attempts, &d.URL, &d.Secret, &d.Event.ID, &d.Event.Type, &payload, &createdAt); err != nil {
+				log.Printf("Error scanning delivery: %v", err)
+				continue
+			}
+			d.Event.Data = json.RawMessage(payload)
+			d.Event.CreatedAt = createdAt.Format(time.RFC3339)
+			batch = append(batch, d)
+		}
+		return rows.Err()
+	}()
+	// The claimed rows keep their bumped next_attempt_at and are retried by a later tick
+	if err != nil {
+		return err
+	}
+
+	for _, d := range batch {
+		statusCode, sendErr := sendWebhook(ctx, d.URL, d.Secret, d.ID, d.Event)
+		attempts := d.Attempts + 1
+
+		var code interface{}
+		if statusCode != 0 {
+			code = statusCode
+		}
+
+		if sendErr == nil {
+			_, err = db.ExecContext(ctx, `
+				UPDATE webhook_deliveries
+				SET status = 'delivered', attempts = $1, last_status_code = $2, last_error = NULL, delivered_at = CURRENT_TIMESTAMP
+				WHERE id = $3
+			`, attempts, code, d.ID)
+		} else if attempts >= maxAttempts {
+			_, err = db.ExecContext(ctx, `
+				UPDATE webhook_deliveries
+				SET status = 'failed', attempts = $1, last_status_code = $2, last_error = $3
+				WHERE id = $4
+			`, attempts, code, sendErr.Error(), d.ID)
+		} else {
+			_, err = db.ExecContext(ctx, `
+				UPDATE webhook_deliveries
+				SET attempts = $1, last_status_code = $2, last_error = $3,
+					next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $4)
+				WHERE id = $5
+			`, attempts, code, sendErr.Error(), retryBackoff(attempts).Seconds(), d.ID)
+		}
+		if err != nil {
+			log.Printf("Error updating delivery %d: %v", d.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// sendWebhook POSTs the event and returns the response status code. Any non-2xx
+// response is treated as a failure so it gets retried.
+func sendWebhook(ctx context.Context, targetURL, secret string, deliveryID int64, event Event) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-Webhook-Signature-256", "sha256="+signPayload(secret, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// signPayload returns the hex encoded HMAC-SHA256 of body keyed with secret
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryBackoff returns the delay before the next attempt: 10s doubled per attempt, capped at 1h
+func retryBackoff(attempt int) time.Duration {
+	const base = 10 * time.Second
+	const maxDelay = time.Hour
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 12 {
+		return maxDelay
+	}
+	delay := base << (attempt - 1)
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignPayload(t *testing.T) {
+	// Reference value from RFC 4231 test case 2
+	got := signPayload("Jefe", []byte("what do ya want for nothing?"))
+	want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		4:  80 * time.Second,
+		20: time.Hour,
+	}
+	for attempt, want := range cases {
+		if got := retryBackoff(attempt); got != want {
+			t.Errorf("attempt %d: expected %v, got %v", attempt, want, got)
+		}
+	}
+}
+
+func TestSendWebhookSignsBody(t *testing.T) {
+	var gotSignature, gotEvent string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get("X-Webhook-Signature-256")
+		gotEvent = r.Header.Get("X-Webhook-Event")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	event := Event{ID: 7, Type: EventReviewerAssigned, Data: json.RawMessage(`{"pull_request_id":"pr-1"}`)}
+	status, err := sendWebhook(context.Background(), server.URL, "s3cret", 1, event)
+	if err != nil {
+		t.Fatalf("Expected delivery to succeed, got %v", err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", status)
+	}
+	if gotEvent != EventReviewerAssigned {
+		t.Errorf("Expected event header %s, got %s", EventReviewerAssigned, gotEvent)
+	}
+	if gotSignature != "sha256="+signPayload("s3cret", gotBody) {
+		t.Errorf("Signature %s does not match body", gotSignature)
+	}
+}
+
+func TestSendWebhookFailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	status, err := sendWebhook(context.Background(), server.URL, "s3cret", 1, Event{Type: EventPullRequestMerged})
+	if err == nil {
+		t.Error("Expected error for 502 response")
+	}
+	if status != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", status)
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	received := make(chan Event, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer server.Close()
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u2', 'Bob', 'backend', true)")
+
+	subReq, _ := json.Marshal(map[string]interface{}{
+		"url":         server.URL,
+		"event_types": []string{EventReviewerAssigned},
+		"secret":      "s3cret",
+	})
+	w := httptest.NewRecorder()
+	webhookAddHandler(w, httptest.NewRequest(http.MethodPost, "/webhooks/add", bytes.NewReader(subReq)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	prReq, _ := json.Marshal(map[string]string{
+		"pull_request_id":   "pr-1001",
+		"pull_request_name": "Add feature",
+		"author_id":         "u1",
+	})
+	w = httptest.NewRecorder()
+	pullRequestCreateHandler(w, httptest.NewRequest(http.MethodPost, "/pullRequest/create", bytes.NewReader(prReq)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if err := dispatchWebhooks(context.Background()); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+
+	select {
+	case event := <-received:
+		if event.Type != EventReviewerAssigned {
+			t.Errorf("Expected %s, got %s", EventReviewerAssigned, event.Type)
+		}
+	default:
+		t.Fatal("Expected a webhook delivery")
+	}
+
+	var status string
+	_ = testDB.QueryRow("SELECT status FROM webhook_deliveries ORDER BY id LIMIT 1").Scan(&status)
+	if status != deliveryDelivered {
+		t.Errorf("Expected delivery status delivered, got %s", status)
+	}
+}
+
+func TestWebhookDeliveriesRejectsUnknownStatus(t *testing.T) {
+	w := httptest.NewRecorder()
+	webhookDeliveriesHandler(w, httptest.NewRequest(http.MethodGet, "/webhooks/deliveries?status=done", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestConcurrentMergesRecordOneEvent(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer cleanupTestDB(testDB)
+	db = testDB
+
+	_, _ = testDB.Exec("INSERT INTO teams (team_name) VALUES ('backend')")
+	_, _ = testDB.Exec("INSERT INTO users (user_id, username, team_name, is_active) VALUES ('u1', 'Alice', 'backend', true)")
+	_, _ = testDB.Exec("INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status) VALUES ('pr-1001', 'Test PR', 'u1', 'OPEN')")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := mergePullRequest("pr-1001"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var merged int
+	_ = testDB.QueryRow("SELECT COUNT(*) FROM events WHERE event_type = $1", EventPullRequestMerged).Scan(&merged)
+	if merged != 1 {
+		t.Errorf("Expected one merged event, got %d", merged)
+	}
+}